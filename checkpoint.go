@@ -0,0 +1,282 @@
+package ziterate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// CheckpointVersion is the version of the TargetIteratorCheckpoint format
+// written by this package.
+const CheckpointVersion = 1
+
+// TargetIteratorCheckpoint is a serializable snapshot of a TargetIterator.
+// Group elements are encoded as decimal strings so the JSON encoding is stable
+// for groups of any size.
+//
+// A checkpoint does not contain the allowed addresses or ports. They must be
+// supplied again when resuming, and must describe the same target space.
+type TargetIteratorCheckpoint struct {
+	Version     int       `json:"version"`
+	Prime       string    `json:"prime"`
+	Generator   string    `json:"generator"`
+	Start       string    `json:"start"`
+	Current     string    `json:"current"`
+	Position    string    `json:"position"`
+	TargetSpace uint64    `json:"target_space"`
+	Seen        uint64    `json:"seen"`
+	Emitted     uint64    `json:"emitted"`
+	Shard       uint16    `json:"shard"`
+	Shards      uint16    `json:"shards"`
+	Sharding    ShardMode `json:"sharding"`
+}
+
+// Checkpoint returns the current state of the iterator. Resuming from the
+// checkpoint yields exactly the targets that Next would have returned after
+// this call. Only iterators backed by a UintGroupIterator or
+// BigIntGroupIterator can be checkpointed, and not those returned by Split.
+func (it *TargetIterator) Checkpoint() (*TargetIteratorCheckpoint, error) {
+	if it.split {
+		return nil, fmt.Errorf("cannot checkpoint an iterator returned by Split")
+	}
+	if it.sample != nil {
+		return nil, fmt.Errorf("cannot checkpoint a sampling iterator")
+	}
+	cp := &TargetIteratorCheckpoint{
+		Version:     CheckpointVersion,
+		TargetSpace: it.targetSpace,
+		Seen:        it.seen,
+		Emitted:     it.emitted,
+		Shard:       it.shard,
+		Shards:      it.shards,
+		Sharding:    it.sharding,
+	}
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		cp.Prime = v.g.P.String()
+		cp.Generator = fmt.Sprint(v.generator)
+		cp.Start = fmt.Sprint(v.start)
+		cp.Current = fmt.Sprint(v.current)
+		cp.Position = fmt.Sprint(v.position)
+	case *BigIntGroupIterator:
+		cp.Prime = v.g.P.String()
+		cp.Generator = v.generator.String()
+		cp.Start = v.start.String()
+		cp.Current = "0"
+		if v.current != nil {
+			cp.Current = v.current.String()
+		}
+		cp.Position = v.position.String()
+	default:
+		return nil, fmt.Errorf("iterator %T does not support checkpoints", it.source())
+	}
+	return cp, nil
+}
+
+// WriteTo writes the checkpoint as a single line of JSON.
+func (cp *TargetIteratorCheckpoint) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadTargetIteratorCheckpoint decodes a checkpoint written by WriteTo.
+func ReadTargetIteratorCheckpoint(r io.Reader) (*TargetIteratorCheckpoint, error) {
+	var cp TargetIteratorCheckpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", cp.Version)
+	}
+	return &cp, nil
+}
+
+// ResumeTargetIterator reconstructs a TargetIterator from a checkpoint. The
+// Allowed and Ports options must produce the same target space as the
+// checkpointed iterator, and Shard, Shards and Group must match it. Random is
+// unused, since the group walk is fully described by the checkpoint.
+// MaxTargets is taken from opts and still counts targets emitted before the
+// checkpoint.
+func ResumeTargetIterator(opts TargetIteratorOptions, cp *TargetIteratorCheckpoint) (*TargetIterator, error) {
+	if cp == nil {
+		return nil, fmt.Errorf("nil checkpoint")
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", cp.Version)
+	}
+	if opts.Allowed == nil || opts.Allowed.Count() == 0 {
+		return nil, fmt.Errorf("no allowed targets")
+	}
+	if len(opts.Ports.Ports) == 0 {
+		opts.Ports = TargetPorts{Ports: []uint16{0}}
+	}
+	if opts.Shards == 0 {
+		opts.Shards = 1
+	}
+	if opts.Shard != cp.Shard || opts.Shards != cp.Shards {
+		return nil, fmt.Errorf("checkpoint is for shard %d of %d, not %d of %d", cp.Shard, cp.Shards, opts.Shard, opts.Shards)
+	}
+	if opts.Sharding != cp.Sharding {
+		return nil, fmt.Errorf("checkpoint is sharded by %s, not by %s", cp.Sharding, opts.Sharding)
+	}
+	if opts.Ordering != OrderByGroup {
+		return nil, fmt.Errorf("checkpoints are not supported with ordering %s", opts.Ordering)
+	}
+	if opts.Sample != nil {
+		return nil, fmt.Errorf("checkpoints are not supported with stratified sampling")
+	}
+	if opts.Index != nil && opts.Index.Count() != opts.Allowed.Count() {
+		return nil, fmt.Errorf("index has %d addresses, allowed set has %d", opts.Index.Count(), opts.Allowed.Count())
+	}
+	targetSpace, err := targetSpaceFor(opts.Allowed, opts.Ports)
+	if err != nil {
+		return nil, err
+	}
+	if targetSpace != cp.TargetSpace {
+		return nil, fmt.Errorf("checkpoint target space %d does not match %d", cp.TargetSpace, targetSpace)
+	}
+	group, err := groupFor(opts.Group, targetSpace)
+	if err != nil {
+		return nil, err
+	}
+	length, bounded := cycleLength(group)
+	stop := length
+	if cp.Sharding == ShardByCycle && bounded {
+		_, stop = shardCycleRange(length, cp.Shard, cp.Shards)
+	}
+	state, err := parseGroupIteratorState(group, cp, stop)
+	if err != nil {
+		return nil, err
+	}
+	var it UintIterator
+	if group.P.Cmp(big.NewInt(PrimeBoundForSmallGroup)) <= 0 {
+		it, err = uintGroupIteratorFromState(group, state)
+	} else {
+		var bigIt *BigIntGroupIterator
+		bigIt, err = bigIntGroupIteratorFromState(group, state)
+		it = bigUintIterator{bigIt}
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &TargetIterator{
+		allowed:     opts.Allowed,
+		index:       opts.Index,
+		ports:       opts.Ports,
+		iterator:    it,
+		targetSpace: targetSpace,
+		shard:       cp.Shard,
+		shards:      cp.Shards,
+		sharding:    cp.Sharding,
+		seen:        cp.Seen,
+		emitted:     cp.Emitted,
+		maxTargets:  opts.MaxTargets,
+	}
+	if err := out.restrictToShard(length, bounded); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// groupIteratorState is the decoded position of a group iterator.
+type groupIteratorState struct {
+	generator *big.Int
+	start     *big.Int
+	current   *big.Int
+	position  *big.Int
+}
+
+func parseGroupIteratorState(g *Group, cp *TargetIteratorCheckpoint, stop uint64) (*groupIteratorState, error) {
+	if cp.Prime != g.P.String() {
+		return nil, fmt.Errorf("checkpoint prime %s does not match group prime %s", cp.Prime, g.P)
+	}
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"generator", cp.Generator},
+		{"start", cp.Start},
+		{"current", cp.Current},
+		{"position", cp.Position},
+	}
+	parsed := make([]*big.Int, len(fields))
+	for i, f := range fields {
+		n, ok := big.NewInt(0).SetString(f.value, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("invalid checkpoint %s: %q", f.name, f.value)
+		}
+		parsed[i] = n
+	}
+	state := &groupIteratorState{
+		generator: parsed[0],
+		start:     parsed[1],
+		current:   parsed[2],
+		position:  parsed[3],
+	}
+	if err := state.validate(g, big.NewInt(0).SetUint64(stop)); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// validate checks that the state describes a reachable point of the walk
+// start * generator^position mod P that ends at position stop.
+func (s *groupIteratorState) validate(g *Group, stop *big.Int) error {
+	if err := g.checkIfMultiplicativeGenerator(s.generator); err != nil {
+		return fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	if s.start.Sign() <= 0 || s.start.Cmp(g.P) >= 0 {
+		return fmt.Errorf("invalid checkpoint: start %s is outside [1, %s)", s.start, g.P)
+	}
+	if s.position.Cmp(stop) > 0 {
+		return fmt.Errorf("invalid checkpoint: position %s is beyond the end of the cycle %s", s.position, stop)
+	}
+	if s.current.Sign() == 0 {
+		if s.position.Cmp(stop) != 0 {
+			return fmt.Errorf("invalid checkpoint: iteration ended at position %s", s.position)
+		}
+		return nil
+	}
+	expected := big.NewInt(0).Exp(s.generator, s.position, g.P)
+	expected.Mul(expected, s.start)
+	expected.Mod(expected, g.P)
+	if expected.Cmp(s.current) != 0 {
+		return fmt.Errorf("invalid checkpoint: current %s is not at position %s", s.current, s.position)
+	}
+	return nil
+}
+
+func uintGroupIteratorFromState(g *Group, s *groupIteratorState) (*UintGroupIterator, error) {
+	if s.generator.Cmp(maxGenerator) > 0 {
+		return nil, fmt.Errorf("invalid checkpoint: generator %s is too big", s.generator)
+	}
+	return &UintGroupIterator{
+		g:         g,
+		prime:     g.P.Uint64(),
+		generator: uint32(s.generator.Uint64()),
+		start:     s.start.Uint64(),
+		current:   s.current.Uint64(),
+		position:  s.position.Uint64(),
+		stop:      g.P.Uint64() - 1,
+	}, nil
+}
+
+func bigIntGroupIteratorFromState(g *Group, s *groupIteratorState) (*BigIntGroupIterator, error) {
+	it := &BigIntGroupIterator{
+		g:         g,
+		generator: s.generator,
+		start:     s.start,
+		current:   s.current,
+		position:  s.position,
+		stop:      big.NewInt(0).Sub(g.P, one),
+	}
+	if s.current.Sign() == 0 {
+		it.current = nil
+	}
+	return it, nil
+}
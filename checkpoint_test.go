@@ -0,0 +1,173 @@
+package ziterate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func checkpointTestOptions(t *testing.T, entries []string, ports string) TargetIteratorOptions {
+	t.Helper()
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetPorts, err := ParseTargetPorts(ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   targetPorts,
+		Random:  NewSeedReader(99),
+	}
+}
+
+func roundTripCheckpoint(t *testing.T, it *TargetIterator) *TargetIteratorCheckpoint {
+	t.Helper()
+	cp, err := it.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := cp.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ReadTargetIteratorCheckpoint(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestTargetIteratorCheckpointResume(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		ports    string
+		sharding ShardMode
+		skip     int
+		compare  int
+	}{
+		{"uint group", []string{"10.0.0.0/22"}, "80,443", ShardByCount, 100, 1 << 20},
+		{"big int group", nil, "1-2048", ShardByCount, 10, 10},
+		{"uint group sharded by cycle", []string{"10.0.0.0/22"}, "80,443", ShardByCycle, 100, 1 << 20},
+		{"big int group sharded by cycle", nil, "1-2048", ShardByCycle, 10, 10},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := checkpointTestOptions(t, tc.entries, tc.ports)
+			opts.Shard, opts.Shards, opts.Sharding = 1, 2, tc.sharding
+			it, err := NewTargetIterator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.skip; i++ {
+				if _, ok := it.Next(); !ok {
+					t.Fatal("iteration ended early")
+				}
+			}
+			cp := roundTripCheckpoint(t, it)
+			resumed, err := ResumeTargetIterator(opts, cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.compare; i++ {
+				want, wantOK := it.Next()
+				got, gotOK := resumed.Next()
+				if got != want || gotOK != wantOK {
+					t.Fatalf("target %d after resume = %v, %v; want %v, %v", i, got, gotOK, want, wantOK)
+				}
+				if !wantOK {
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestTargetIteratorCheckpointAfterCompletion(t *testing.T) {
+	opts := checkpointTestOptions(t, []string{"10.0.0.0/30"}, "")
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+	}
+	resumed, err := ResumeTargetIterator(opts, roundTripCheckpoint(t, it))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, ok := resumed.Next(); ok {
+		t.Fatalf("resumed iterator returned %v after completion", target)
+	}
+}
+
+func TestTargetIteratorCheckpointMaxTargetsCarriesOver(t *testing.T) {
+	opts := checkpointTestOptions(t, []string{"10.0.0.0/24"}, "")
+	opts.MaxTargets = 10
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		it.Next()
+	}
+	resumed, err := ResumeTargetIterator(opts, roundTripCheckpoint(t, it))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, ok := resumed.Next(); ok; _, ok = resumed.Next() {
+		count++
+	}
+	if count != 6 {
+		t.Fatalf("resumed iterator emitted %d targets, want 6", count)
+	}
+}
+
+func TestResumeTargetIteratorRejectsMismatch(t *testing.T) {
+	opts := checkpointTestOptions(t, []string{"10.0.0.0/24"}, "")
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it.Next()
+	cp, err := it.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := checkpointTestOptions(t, []string{"10.0.0.0/23"}, "")
+	if _, err := ResumeTargetIterator(other, cp); err == nil {
+		t.Error("expected error for different target space")
+	}
+	sharded := opts
+	sharded.Shards = 2
+	if _, err := ResumeTargetIterator(sharded, cp); err == nil {
+		t.Error("expected error for different sharding")
+	}
+	byCycle := opts
+	byCycle.Sharding = ShardByCycle
+	if _, err := ResumeTargetIterator(byCycle, cp); err == nil {
+		t.Error("expected error for different shard mode")
+	}
+	tampered := *cp
+	tampered.Current = "2"
+	if tampered.Current == cp.Current {
+		tampered.Current = "3"
+	}
+	if _, err := ResumeTargetIterator(opts, &tampered); err == nil {
+		t.Error("expected error for inconsistent current element")
+	}
+	if _, err := ReadTargetIteratorCheckpoint(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
+
+func TestTargetIteratorCheckpointUnsupportedIterator(t *testing.T) {
+	it := &TargetIterator{iterator: &sequenceIterator{}}
+	if _, err := it.Checkpoint(); err == nil {
+		t.Fatal("expected error checkpointing a custom iterator")
+	}
+}
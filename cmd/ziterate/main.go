@@ -2,42 +2,105 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"math/bits"
+	"net"
+	"net/netip"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/zmap/ziterate"
 )
 
 func main() {
-	if err := run(os.Args[1:], os.Stdout); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runContext(ctx, os.Args[1:], os.Stdout); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// stderr receives warnings, such as the invalid lines skipped with
+// --lenient.
+var stderr io.Writer = os.Stderr
+
 func run(args []string, stdout io.Writer) error {
-	flags := flag.NewFlagSet("ziterate", flag.ContinueOnError)
+	return runContext(context.Background(), args, stdout)
+}
+
+// runContext runs the CLI until iteration completes or ctx is canceled. When
+// ctx is canceled and a checkpoint file is configured, the checkpoint is
+// written before returning.
+//
+// The "locate" and "ranges" subcommands take the same flags as a scan. Instead
+// of printing targets, locate prints where each --target falls in the scan,
+// and ranges prints the allowed addresses.
+func runContext(ctx context.Context, args []string, stdout io.Writer) error {
+	var subcommand string
+	if len(args) > 0 && (args[0] == "locate" || args[0] == "ranges") {
+		subcommand, args = args[0], args[1:]
+	}
+	locate := subcommand == "locate"
+	name := strings.TrimSpace("ziterate " + subcommand)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
 	flags.SetOutput(stdout)
 
+	var locateTargets []ziterate.Target
+	if locate {
+		flags.Func("target", "target to locate, as ip or ip,port; may be repeated", func(s string) error {
+			target, err := parseTarget(s)
+			if err != nil {
+				return err
+			}
+			locateTargets = append(locateTargets, target)
+			return nil
+		})
+	}
+	var cidr bool
+	if subcommand == "ranges" {
+		flags.BoolVar(&cidr, "cidr", false, "print the smallest list of CIDR prefixes instead of address ranges")
+	}
+
 	var blocklistFile string
 	flags.StringVar(&blocklistFile, "b", "", "blocklist file")
 	flags.StringVar(&blocklistFile, "blocklist-file", "", "blocklist file")
 	var allowlistFile string
 	flags.StringVar(&allowlistFile, "w", "", "allowlist file")
 	flags.StringVar(&allowlistFile, "allowlist-file", "", "allowlist file")
+	var excludePresets []string
+	flags.Func("exclude-preset", "built-in blocklist to exclude: "+strings.Join(ziterate.IPv4PresetNames(), ", ")+"; may be repeated or comma separated", func(s string) error {
+		for _, name := range strings.Split(s, ",") {
+			excludePresets = append(excludePresets, strings.TrimSpace(name))
+		}
+		return nil
+	})
+	var resolveHostnames bool
+	flags.BoolVar(&resolveHostnames, "resolve-hostnames", false, "resolve hostnames in allowlists and blocklists to their IPv4 addresses")
+	var strict, lenient bool
+	flags.BoolVar(&strict, "strict", false, "fail if any allowlist or blocklist line is invalid, listing every invalid line (the default)")
+	flags.BoolVar(&lenient, "lenient", false, "skip invalid allowlist and blocklist lines, with a warning for each")
 	var portsDef string
 	flags.StringVar(&portsDef, "p", "", "target ports")
 	flags.StringVar(&portsDef, "target-ports", "", "target ports")
 	var seed uint64
 	flags.Uint64Var(&seed, "e", 0, "seed")
 	flags.Uint64Var(&seed, "seed", 0, "seed")
+	var seedVersionDef string
+	flags.StringVar(&seedVersionDef, "seed-version", "1", "how the seed selects the ordering: 1, or mathrand for releases before seed versions")
 	var maxTargetsDef string
 	flags.StringVar(&maxTargetsDef, "n", "", "max targets")
 	flags.StringVar(&maxTargetsDef, "max-targets", "", "max targets")
@@ -45,6 +108,45 @@ func run(args []string, stdout io.Writer) error {
 	flags.UintVar(&shard, "shard", 0, "shard number")
 	var shards uint
 	flags.UintVar(&shards, "shards", 1, "total shards")
+	var shardModeDef string
+	flags.StringVar(&shardModeDef, "shard-mode", "count", "how shards split the cycle: count or cycle")
+	var ipv6 bool
+	flags.BoolVar(&ipv6, "6", false, "iterate over IPv6 targets")
+	flags.BoolVar(&ipv6, "ipv6", false, "iterate over IPv6 targets")
+	var checkpointFile string
+	flags.StringVar(&checkpointFile, "checkpoint-file", "", "file to save iterator state to on exit")
+	var checkpointInterval uint64
+	flags.Uint64Var(&checkpointInterval, "checkpoint-interval", 0, "also save a checkpoint every N targets")
+	var resume bool
+	flags.BoolVar(&resume, "resume", false, "resume from the state in --checkpoint-file")
+	var threads uint
+	flags.UintVar(&threads, "threads", 1, "number of goroutines generating targets; output order is not deterministic when greater than 1")
+	var generateGroup bool
+	flags.BoolVar(&generateGroup, "generate-group", false, "walk a group generated for the exact target space instead of the smallest ZMap group")
+	var orderingDef string
+	flags.StringVar(&orderingDef, "ordering", "group", "how targets are permuted: group or feistel")
+	var groupFile string
+	flags.StringVar(&groupFile, "group-file", "", "JSON file with the cyclic group to walk")
+	var outputFormatDef string
+	flags.StringVar(&outputFormatDef, "output-format", "text", "output format: text, csv, jsonl, or binary")
+	var labels bool
+	flags.BoolVar(&labels, "labels", false, "add a column with the label of each target's allowlist line")
+	var stratify bool
+	flags.BoolVar(&stratify, "stratify", false, "sample --max-targets targets across the allowlist lines instead of taking the first ones")
+	var minPerRange uint64
+	flags.Uint64Var(&minPerRange, "min-per-range", 0, "with --stratify, sample at least N targets from each range")
+	var rangeWeightsDef string
+	flags.StringVar(&rangeWeightsDef, "range-weights", "", "with --stratify, comma-separated weights, one per allowlist line: command-line entries, then --allowlist-file")
+	var rate uint64
+	flags.Uint64Var(&rate, "r", 0, "send rate in packets per second")
+	flags.Uint64Var(&rate, "rate", 0, "send rate in packets per second")
+	var bandwidthDef string
+	flags.StringVar(&bandwidthDef, "B", "", "send rate in bits per second (supports suffixes G, M and K)")
+	flags.StringVar(&bandwidthDef, "bandwidth", "", "send rate in bits per second (supports suffixes G, M and K)")
+	var packetSize uint
+	flags.UintVar(&packetSize, "packet-size", 54, "probe packet size in bytes, used to convert --bandwidth to a packet rate")
+	var burst uint
+	flags.UintVar(&burst, "burst", 0, "targets that may be sent at once when pacing with --rate or --bandwidth (default 10ms worth)")
 
 	if err := flags.Parse(args); err != nil {
 		if err == flag.ErrHelp {
@@ -59,36 +161,163 @@ func run(args []string, stdout io.Writer) error {
 			seedGiven = true
 		}
 	})
-	if shards > 1 && !seedGiven {
+	if locate && len(locateTargets) == 0 {
+		return fmt.Errorf("locate requires at least one --target")
+	}
+	if strict && lenient {
+		return fmt.Errorf("--strict cannot be combined with --lenient")
+	}
+	if resume && checkpointFile == "" {
+		return fmt.Errorf("--resume requires --checkpoint-file")
+	}
+	if threads == 0 {
+		return fmt.Errorf("threads must be at least 1")
+	}
+	if threads > 1 && checkpointFile != "" {
+		return fmt.Errorf("checkpoints are not supported with more than one thread")
+	}
+	if generateGroup && groupFile != "" {
+		return fmt.Errorf("--generate-group cannot be combined with --group-file")
+	}
+	if (minPerRange > 0 || rangeWeightsDef != "") && !stratify {
+		return fmt.Errorf("--min-per-range and --range-weights require --stratify")
+	}
+	if rate > 0 && bandwidthDef != "" {
+		return fmt.Errorf("--rate cannot be combined with --bandwidth")
+	}
+	if stratify && maxTargetsDef == "" {
+		return fmt.Errorf("--stratify requires --max-targets")
+	}
+	if stratify && (checkpointFile != "" || ipv6 || locate) {
+		return fmt.Errorf("--stratify cannot be combined with checkpoints, IPv6, or locate")
+	}
+	if shards > 1 && !seedGiven && !resume {
 		return fmt.Errorf("seed is required when sharding")
 	}
 	if shard >= math.MaxUint16 || shards > math.MaxUint16 {
 		return fmt.Errorf("shard values must fit in uint16")
 	}
 
+	sharding, err := ziterate.ParseShardMode(shardModeDef)
+	if err != nil {
+		return err
+	}
+	outputFormat, err := ziterate.ParseOutputFormat(outputFormatDef)
+	if err != nil {
+		return err
+	}
+	ordering, err := ziterate.ParseOrdering(orderingDef)
+	if err != nil {
+		return err
+	}
+	if ordering != ziterate.OrderByGroup && (checkpointFile != "" || generateGroup || groupFile != "") {
+		return fmt.Errorf("--ordering %s cannot be combined with checkpoints or groups", ordering)
+	}
+	var group *ziterate.Group
+	if groupFile != "" {
+		if group, err = readGroup(groupFile); err != nil {
+			return err
+		}
+	}
+
+	seedVersion, err := ziterate.ParseSeedVersion(seedVersionDef)
+	if err != nil {
+		return err
+	}
 	var randomReader io.Reader = rand.Reader
 	if seedGiven {
-		randomReader = ziterate.NewSeedReader(seed)
+		randomReader, err = ziterate.NewSeedReaderVersion(seed, seedVersion)
+		if err != nil {
+			return err
+		}
 	}
 
 	ports, err := ziterate.ParseTargetPorts(portsDef)
 	if err != nil {
 		return err
 	}
-
-	rangeOpts := ziterate.IPv4RangeSetOptions{
-		AllowEntries: flags.Args(),
+	packetRate := float64(rate)
+	if bandwidthDef != "" {
+		bandwidth, err := parseBandwidth(bandwidthDef)
+		if err != nil {
+			return err
+		}
+		packetRate = ziterate.RateForBandwidth(bandwidth, int(packetSize))
 	}
+
+	var allowFiles, blockFiles []string
 	if allowlistFile != "" {
-		rangeOpts.AllowFiles = []string{allowlistFile}
+		allowFiles = []string{allowlistFile}
 	}
 	if blocklistFile != "" {
-		rangeOpts.BlockFiles = []string{blocklistFile}
+		blockFiles = []string{blocklistFile}
+	}
+	for _, entry := range flags.Args() {
+		if strings.Contains(entry, ":") {
+			ipv6 = true
+		}
+	}
+	if ipv6 {
+		if checkpointFile != "" {
+			return fmt.Errorf("checkpoints are only supported for IPv4 targets")
+		}
+		if sharding != ziterate.ShardByCount {
+			return fmt.Errorf("shard mode %s is only supported for IPv4 targets", sharding)
+		}
+		if threads > 1 {
+			return fmt.Errorf("threads are only supported for IPv4 targets")
+		}
+		if outputFormat != ziterate.OutputText {
+			return fmt.Errorf("output format %s is only supported for IPv4 targets", outputFormat)
+		}
+		if generateGroup {
+			return fmt.Errorf("--generate-group is only supported for IPv4 targets")
+		}
+		if labels {
+			return fmt.Errorf("--labels is only supported for IPv4 targets")
+		}
+		if ordering != ziterate.OrderByGroup {
+			return fmt.Errorf("ordering %s is only supported for IPv4 targets", ordering)
+		}
+		if subcommand != "" {
+			return fmt.Errorf("%s is only supported for IPv4 targets", subcommand)
+		}
+		if stratify {
+			return fmt.Errorf("--stratify is only supported for IPv4 targets")
+		}
+		if rate > 0 || bandwidthDef != "" {
+			return fmt.Errorf("--rate and --bandwidth are only supported for IPv4 targets")
+		}
+		if len(excludePresets) > 0 || resolveHostnames {
+			return fmt.Errorf("--exclude-preset and --resolve-hostnames are only supported for IPv4 targets")
+		}
+		return runIPv6(stdout, ziterate.IPv6RangeSetOptions{
+			AllowEntries:  flags.Args(),
+			AllowFiles:    allowFiles,
+			BlockFiles:    blockFiles,
+			Lenient:       lenient,
+			OnInvalidLine: warnInvalidLine,
+		}, ports, randomReader, group, uint16(shard), uint16(shards), maxTargetsDef)
+	}
+
+	rangeOpts := ziterate.IPv4RangeSetOptions{
+		AllowEntries:   flags.Args(),
+		AllowFiles:     allowFiles,
+		BlockFiles:     blockFiles,
+		ExcludePresets: excludePresets,
+		Lenient:        lenient,
+		OnInvalidLine:  warnInvalidLine,
+	}
+	if resolveHostnames {
+		rangeOpts.Resolver = net.DefaultResolver
 	}
 	allowed, err := ziterate.NewIPv4RangeSet(rangeOpts)
 	if err != nil {
 		return err
 	}
+	if subcommand == "ranges" {
+		return writeRanges(stdout, allowed, cidr)
+	}
 
 	targetSpace, err := targetSpaceSize(allowed.Count(), len(ports.Ports))
 	if err != nil {
@@ -99,13 +328,360 @@ func run(args []string, stdout io.Writer) error {
 		return err
 	}
 
-	it, err := ziterate.NewTargetIterator(ziterate.TargetIteratorOptions{
+	opts := ziterate.TargetIteratorOptions{
 		Allowed:    allowed,
 		Ports:      ports,
 		Random:     randomReader,
 		Shard:      uint16(shard),
 		Shards:     uint16(shards),
+		Sharding:   sharding,
+		MaxTargets: maxTargets,
+		Group:      group,
+		Ordering:   ordering,
+	}
+	index, err := ziterate.NewPagedIPv4Index(allowed)
+	if err != nil {
+		return err
+	}
+	opts.Index = index
+	if stratify {
+		if sharding != ziterate.ShardByCount {
+			return fmt.Errorf("--stratify is only supported with shard mode count")
+		}
+		weights, err := parseRangeWeights(rangeWeightsDef)
+		if err != nil {
+			return err
+		}
+		opts.Sample = &ziterate.StratifiedSample{Total: maxTargets, Minimum: minPerRange, Weights: weights}
+		opts.MaxTargets = 0
+	}
+	if generateGroup {
+		opts.Group, err = ziterate.GenerateGroup(targetSpace, nil)
+		if err != nil {
+			return err
+		}
+	}
+	var it *ziterate.TargetIterator
+	if resume {
+		cp, err := readCheckpoint(checkpointFile)
+		if err != nil {
+			return err
+		}
+		it, err = ziterate.ResumeTargetIterator(opts, cp)
+		if err != nil {
+			return err
+		}
+	} else {
+		it, err = ziterate.NewTargetIterator(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if locate {
+		return writePositions(stdout, it, locateTargets)
+	}
+
+	newWriter := ziterate.NewTargetWriter
+	if labels {
+		newWriter = ziterate.NewLabeledTargetWriter
+	}
+	out, err := newWriter(stdout, outputFormat)
+	if err != nil {
+		return err
+	}
+	var bucket *ziterate.TokenBucket
+	if packetRate > 0 {
+		if burst == 0 {
+			burst = uint(max(1, packetRate/100))
+		}
+		bucket, err = ziterate.NewTokenBucket(packetRate, int(burst), flushingClock{out})
+		if err != nil {
+			return err
+		}
+	}
+	if threads > 1 {
+		parts, err := it.Split(int(threads))
+		if err != nil {
+			return err
+		}
+		if err := writeConcurrently(ctx, out, parts, bucket); err != nil {
+			out.Flush()
+			return err
+		}
+		return out.Flush()
+	}
+	next := func() (ziterate.TargetRecord, bool, error) {
+		record, ok := it.NextRecord()
+		return record, ok, nil
+	}
+	var limited *ziterate.RateLimitedIterator
+	if bucket != nil {
+		limited = ziterate.NewRateLimitedIterator(it, bucket)
+		next = func() (ziterate.TargetRecord, bool, error) {
+			return limited.NextRecord(ctx)
+		}
+	}
+	written := uint64(0)
+	for {
+		record, ok, err := next()
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if err == nil {
+			if !ok {
+				break
+			}
+			if err := out.WriteTarget(record); err != nil {
+				return err
+			}
+			written++
+			if checkpointFile != "" && checkpointInterval > 0 && written%checkpointInterval == 0 {
+				if err := writeCheckpoint(out, checkpointFile, it); err != nil {
+					return err
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			// The checkpoint is already past a target whose wait was
+			// canceled, so print it rather than skip it.
+			if limited != nil {
+				if record, ok := limited.Pending(); ok {
+					if err := out.WriteTarget(record); err != nil {
+						return err
+					}
+					written++
+				}
+			}
+			if checkpointFile != "" {
+				if err := writeCheckpoint(out, checkpointFile, it); err != nil {
+					return err
+				}
+			}
+			out.Flush()
+			return fmt.Errorf("interrupted after %d targets", written)
+		}
+	}
+	if checkpointFile != "" {
+		return writeCheckpoint(out, checkpointFile, it)
+	}
+	return out.Flush()
+}
+
+// targetBatchSize is the number of targets each thread sends to the writer at
+// a time.
+const targetBatchSize = 1024
+
+// writeConcurrently drives each iterator from its own goroutine and writes the
+// targets they produce from the calling goroutine.
+func writeConcurrently(ctx context.Context, out ziterate.TargetWriter, parts []*ziterate.TargetIterator, bucket *ziterate.TokenBucket) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan []ziterate.TargetRecord, len(parts))
+	var wg sync.WaitGroup
+	for _, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := make([]ziterate.TargetRecord, 0, targetBatchSize)
+			for record, ok := part.NextRecord(); ok; record, ok = part.NextRecord() {
+				batch = append(batch, record)
+				if len(batch) < targetBatchSize {
+					continue
+				}
+				select {
+				case batches <- batch:
+				case <-ctx.Done():
+					return
+				}
+				batch = make([]ziterate.TargetRecord, 0, targetBatchSize)
+			}
+			if len(batch) > 0 {
+				select {
+				case batches <- batch:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(batches)
+	}()
+	written := uint64(0)
+	var writeErr error
+	for batch := range batches {
+		for _, record := range batch {
+			if writeErr != nil {
+				break
+			}
+			if bucket != nil {
+				if err := bucket.Wait(ctx); err != nil {
+					if ctx.Err() == nil {
+						writeErr = err
+						cancel()
+					}
+					break
+				}
+			}
+			if writeErr = out.WriteTarget(record); writeErr != nil {
+				cancel()
+				break
+			}
+			written++
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted after %d targets", written)
+	}
+	return nil
+}
+
+// parseTarget parses a target written as "ip" or "ip,port", the same form as
+// the text output.
+func parseTarget(s string) (ziterate.Target, error) {
+	ipDef, portDef, hasPort := strings.Cut(s, ",")
+	addr, err := netip.ParseAddr(strings.TrimSpace(ipDef))
+	if err != nil || !addr.Is4() {
+		return ziterate.Target{}, fmt.Errorf("invalid IPv4 target: %s", s)
+	}
+	ip := addr.As4()
+	target := ziterate.Target{IP: binary.BigEndian.Uint32(ip[:]), HasPort: hasPort}
+	if hasPort {
+		port, err := strconv.ParseUint(strings.TrimSpace(portDef), 10, 16)
+		if err != nil {
+			return ziterate.Target{}, fmt.Errorf("invalid port in target: %s", s)
+		}
+		target.Port = uint16(port)
+	}
+	return target, nil
+}
+
+// writePositions prints the position of each target in the scan, one line per
+// target. It fails for groups that PositionOf rejects: those where P - 1 has a
+// prime factor above 2^44, such as the groups for 2^64 + 13 and 2^80 + 13,
+// and possibly a --generate-group or --group-file group.
+func writePositions(stdout io.Writer, it *ziterate.TargetIterator, targets []ziterate.Target) error {
+	out := bufio.NewWriter(stdout)
+	for _, target := range targets {
+		position, err := it.PositionOf(target)
+		if err != nil {
+			out.Flush()
+			return err
+		}
+		addr := ziterate.Uint32ToIPv4(target.IP)
+		if target.HasPort {
+			fmt.Fprintf(out, "%s,%d", addr, target.Port)
+		} else {
+			fmt.Fprint(out, addr)
+		}
+		fmt.Fprintf(out, " cycle_index=%d index=%d shard=%d\n", position.CycleIndex, position.Index, position.Shard)
+	}
+	return out.Flush()
+}
+
+// warnInvalidLine reports an allowlist or blocklist line skipped with
+// --lenient.
+func warnInvalidLine(err *ziterate.RangeParseError) {
+	fmt.Fprintf(stderr, "warning: skipping %v\n", err)
+}
+
+// writeRanges prints the allowed addresses, one range per line, as "start-end",
+// or just the address for a range of one address. With cidr, it prints the
+// smallest list of prefixes instead.
+func writeRanges(stdout io.Writer, allowed *ziterate.IPv4RangeSet, cidr bool) error {
+	out := bufio.NewWriter(stdout)
+	if cidr {
+		for _, prefix := range allowed.Prefixes() {
+			fmt.Fprintln(out, prefix)
+		}
+		return out.Flush()
+	}
+	for _, r := range allowed.Ranges() {
+		if r.Start == r.End {
+			fmt.Fprintln(out, ziterate.Uint32ToIPv4(r.Start))
+		} else {
+			fmt.Fprintf(out, "%s-%s\n", ziterate.Uint32ToIPv4(r.Start), ziterate.Uint32ToIPv4(r.End))
+		}
+	}
+	return out.Flush()
+}
+
+func readGroup(path string) (*ziterate.Group, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	g, err := ziterate.ReadGroup(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+func readCheckpoint(path string) (*ziterate.TargetIteratorCheckpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cp, err := ziterate.ReadTargetIteratorCheckpoint(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint flushes out, so the checkpoint never runs ahead of the
+// printed targets, and then atomically replaces the checkpoint file.
+func writeCheckpoint(out ziterate.TargetWriter, path string, it *ziterate.TargetIterator) error {
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	cp, err := it.Checkpoint()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, writeErr := cp.WriteTo(tmp)
+	closeErr := tmp.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmp.Name())
+		return writeErr
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func runIPv6(stdout io.Writer, rangeOpts ziterate.IPv6RangeSetOptions, ports ziterate.TargetPorts, randomReader io.Reader, group *ziterate.Group, shard, shards uint16, maxTargetsDef string) error {
+	allowed, err := ziterate.NewIPv6RangeSet(rangeOpts)
+	if err != nil {
+		return err
+	}
+	targetSpace := allowed.Count()
+	targetSpace.Mul(targetSpace, big.NewInt(int64(len(ports.Ports))))
+	maxTargets, err := parseMaxTargets(maxTargetsDef, saturatingUint64(targetSpace))
+	if err != nil {
+		return err
+	}
+
+	it, err := ziterate.NewIPv6TargetIterator(ziterate.IPv6TargetIteratorOptions{
+		Allowed:    allowed,
+		Ports:      ports,
+		Random:     randomReader,
+		Shard:      shard,
+		Shards:     shards,
 		MaxTargets: maxTargets,
+		Group:      group,
 	})
 	if err != nil {
 		return err
@@ -114,16 +690,23 @@ func run(args []string, stdout io.Writer) error {
 	out := bufio.NewWriter(stdout)
 	defer out.Flush()
 	for target, ok := it.Next(); ok; target, ok = it.Next() {
-		ip := ziterate.Uint32ToIPv4(target.IP)
 		if target.HasPort {
-			fmt.Fprintf(out, "%s,%d\n", ip, target.Port)
+			fmt.Fprintf(out, "%s,%d\n", target.IP, target.Port)
 		} else {
-			fmt.Fprintln(out, ip)
+			fmt.Fprintln(out, target.IP)
 		}
 	}
 	return nil
 }
 
+// saturatingUint64 returns n, or math.MaxUint64 if n does not fit.
+func saturatingUint64(n *big.Int) uint64 {
+	if !n.IsUint64() {
+		return math.MaxUint64
+	}
+	return n.Uint64()
+}
+
 func targetSpaceSize(addrCount uint64, portCount int) (uint64, error) {
 	hi, lo := bits.Mul64(addrCount, uint64(portCount))
 	if hi != 0 {
@@ -132,6 +715,63 @@ func targetSpaceSize(addrCount uint64, portCount int) (uint64, error) {
 	return lo, nil
 }
 
+// parseBandwidth parses a --bandwidth in bits per second, with an optional G,
+// M or K suffix.
+func parseBandwidth(def string) (float64, error) {
+	digits := strings.TrimSpace(def)
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(digits, "G"), strings.HasSuffix(digits, "g"):
+		multiplier = 1_000_000_000
+	case strings.HasSuffix(digits, "M"), strings.HasSuffix(digits, "m"):
+		multiplier = 1_000_000
+	case strings.HasSuffix(digits, "K"), strings.HasSuffix(digits, "k"):
+		multiplier = 1_000
+	}
+	if multiplier > 1 {
+		digits = digits[:len(digits)-1]
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid bandwidth: %s", def)
+	}
+	return float64(n) * float64(multiplier), nil
+}
+
+// flushingClock is the system clock, except that it flushes out before
+// sleeping, so that paced targets reach the reader on time rather than when
+// the output buffer fills.
+type flushingClock struct {
+	out ziterate.TargetWriter
+}
+
+func (c flushingClock) Now() time.Time {
+	return ziterate.SystemClock.Now()
+}
+
+func (c flushingClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := c.out.Flush(); err != nil {
+		return err
+	}
+	return ziterate.SystemClock.Sleep(ctx, d)
+}
+
+// parseRangeWeights parses a comma-separated list of --range-weights.
+func parseRangeWeights(def string) ([]float64, error) {
+	if def == "" {
+		return nil, nil
+	}
+	var out []float64
+	for _, field := range strings.Split(def, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range weight: %s", field)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
 func parseMaxTargets(def string, targetSpace uint64) (uint64, error) {
 	def = strings.TrimSpace(def)
 	if def == "" {
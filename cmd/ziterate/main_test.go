@@ -2,8 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunDeterministicSeed(t *testing.T) {
@@ -41,6 +48,53 @@ func TestRunPortsOutput(t *testing.T) {
 	}
 }
 
+func TestRunShardModeCycle(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, shard := range []string{"0", "1", "2"} {
+		var out bytes.Buffer
+		if err := run([]string{"-e", "9", "--shards", "3", "--shard", shard, "--shard-mode", "cycle", "10.0.0.0/26"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range nonEmptyLines(out.String()) {
+			if seen[line] {
+				t.Fatalf("%s emitted by more than one shard", line)
+			}
+			seen[line] = true
+		}
+	}
+	if len(seen) != 64 {
+		t.Fatalf("shards emitted %d targets, want 64", len(seen))
+	}
+	var out bytes.Buffer
+	if err := run([]string{"--shard-mode", "strided", "10.0.0.0/30"}, &out); err == nil {
+		t.Fatal("expected unknown shard mode to fail")
+	}
+}
+
+func TestRunThreads(t *testing.T) {
+	for _, mode := range []string{"count", "cycle"} {
+		var single bytes.Buffer
+		if err := run([]string{"-e", "4", "--shard-mode", mode, "-p", "80,443", "10.0.0.0/22"}, &single); err != nil {
+			t.Fatal(err)
+		}
+		var threaded bytes.Buffer
+		if err := run([]string{"-e", "4", "--shard-mode", mode, "--threads", "4", "-p", "80,443", "10.0.0.0/22"}, &threaded); err != nil {
+			t.Fatal(err)
+		}
+		want := nonEmptyLines(single.String())
+		got := nonEmptyLines(threaded.String())
+		sort.Strings(want)
+		sort.Strings(got)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("%s: threaded output has %d lines, single has %d", mode, len(got), len(want))
+		}
+	}
+	var out bytes.Buffer
+	if err := run([]string{"--threads", "2", "--checkpoint-file", "x", "10.0.0.0/30"}, &out); err == nil {
+		t.Fatal("expected threads with checkpoints to fail")
+	}
+}
+
 func TestRunShardingRequiresSeed(t *testing.T) {
 	var out bytes.Buffer
 	if err := run([]string{"--shards", "2", "--shard", "1", "10.0.0.0/30"}, &out); err == nil {
@@ -66,6 +120,126 @@ func TestRunLongFlagsAndPercentMaxTargets(t *testing.T) {
 	}
 }
 
+func TestRunIPv6(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-e", "3", "-p", "443", "2001:db8::/126"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := nonEmptyLines(out.String())
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %q", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "2001:db8::") || !strings.HasSuffix(line, ",443") {
+			t.Fatalf("unexpected IPv6 output %q", line)
+		}
+	}
+}
+
+func TestRunIPv6AllowlistFile(t *testing.T) {
+	allowFile := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(allowFile, []byte("2001:db8::/127\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"--ipv6", "--allowlist-file", allowFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := nonEmptyLines(out.String()); len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), out.String())
+	}
+}
+
+func TestRunCheckpointResume(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "state.json")
+	var full bytes.Buffer
+	if err := run([]string{"-e", "5", "-n", "6", "10.0.0.0/24"}, &full); err != nil {
+		t.Fatal(err)
+	}
+	var first bytes.Buffer
+	if err := run([]string{"-e", "5", "-n", "6", "--checkpoint-file", checkpoint, "10.0.0.0/24"}, &first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	var second bytes.Buffer
+	if err := run([]string{"-n", "10", "--checkpoint-file", checkpoint, "--resume", "10.0.0.0/24"}, &second); err != nil {
+		t.Fatal(err)
+	}
+	if got := nonEmptyLines(second.String()); len(got) != 4 {
+		t.Fatalf("resumed run printed %d lines, want 4: %q", len(got), second.String())
+	}
+	var all bytes.Buffer
+	if err := run([]string{"-e", "5", "-n", "10", "10.0.0.0/24"}, &all); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first.String()+second.String(), all.String(); got != want {
+		t.Fatalf("checkpointed output differed:\n%s\n---\n%s", got, want)
+	}
+	if first.String() != full.String() {
+		t.Fatal("writing a checkpoint changed the output")
+	}
+}
+
+func TestRunInterruptedWritesCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var first bytes.Buffer
+	err := runContext(ctx, []string{"-e", "5", "--checkpoint-file", checkpoint, "10.0.0.0/28"}, &first)
+	if err == nil {
+		t.Fatal("expected interrupted run to fail")
+	}
+	if got := nonEmptyLines(first.String()); len(got) != 1 {
+		t.Fatalf("interrupted run printed %d lines, want 1", len(got))
+	}
+	var second bytes.Buffer
+	if err := run([]string{"--checkpoint-file", checkpoint, "--resume", "10.0.0.0/28"}, &second); err != nil {
+		t.Fatal(err)
+	}
+	var all bytes.Buffer
+	if err := run([]string{"-e", "5", "10.0.0.0/28"}, &all); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first.String()+second.String(), all.String(); got != want {
+		t.Fatalf("resumed output differed:\n%s\n---\n%s", got, want)
+	}
+}
+
+func TestRunInterruptedWhilePacing(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var first bytes.Buffer
+	err := runContext(ctx, []string{"-e", "5", "--rate", "1000", "--checkpoint-file", checkpoint, "10.0.0.0/28"}, &first)
+	if err == nil {
+		t.Fatal("expected interrupted run to fail")
+	}
+	// The target whose wait was canceled is printed, not skipped.
+	if got := nonEmptyLines(first.String()); len(got) != 1 {
+		t.Fatalf("interrupted run printed %d lines, want 1", len(got))
+	}
+	var second bytes.Buffer
+	if err := run([]string{"--checkpoint-file", checkpoint, "--resume", "10.0.0.0/28"}, &second); err != nil {
+		t.Fatal(err)
+	}
+	var all bytes.Buffer
+	if err := run([]string{"-e", "5", "10.0.0.0/28"}, &all); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first.String()+second.String(), all.String(); got != want {
+		t.Fatalf("resumed output differed:\n%s\n---\n%s", got, want)
+	}
+}
+
+func TestRunResumeRequiresCheckpointFile(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"--resume", "10.0.0.0/30"}, &out); err == nil {
+		t.Fatal("expected --resume without --checkpoint-file to fail")
+	}
+}
+
 func TestRunHelp(t *testing.T) {
 	var out bytes.Buffer
 	if err := run([]string{"--help"}, &out); err != nil {
@@ -87,3 +261,444 @@ func nonEmptyLines(s string) []string {
 	}
 	return out
 }
+
+func TestRunOutputFormats(t *testing.T) {
+	args := []string{"-e", "5", "-p", "80", "10.0.0.0/30"}
+	var csvOut bytes.Buffer
+	if err := run(append([]string{"--output-format", "csv"}, args...), &csvOut); err != nil {
+		t.Fatal(err)
+	}
+	lines := nonEmptyLines(csvOut.String())
+	if len(lines) != 5 || lines[0] != "ip,port,index,shard" {
+		t.Fatalf("unexpected CSV output: %q", csvOut.String())
+	}
+
+	var jsonOut bytes.Buffer
+	if err := run(append([]string{"--output-format", "jsonl"}, args...), &jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	lines = nonEmptyLines(jsonOut.String())
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], `{"ip":"10.0.0.`) {
+		t.Fatalf("unexpected JSON lines output: %q", jsonOut.String())
+	}
+
+	var binOut bytes.Buffer
+	if err := run(append([]string{"--output-format", "binary", "--threads", "2"}, args...), &binOut); err != nil {
+		t.Fatal(err)
+	}
+	if binOut.Len() != 4*6 {
+		t.Fatalf("got %d bytes of binary output, want %d", binOut.Len(), 4*6)
+	}
+
+	if err := run([]string{"--output-format", "xml", "10.0.0.0/30"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unknown output format")
+	}
+}
+
+func TestRunGenerateGroup(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "state.json")
+	var out bytes.Buffer
+	args := []string{"-e", "8", "--generate-group", "--checkpoint-file", checkpoint, "10.0.0.0/22"}
+	if err := run(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := nonEmptyLines(out.String())
+	if len(lines) != 1024 {
+		t.Fatalf("got %d targets, want 1024", len(lines))
+	}
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"prime":"1031"`) {
+		t.Fatalf("checkpoint does not use the generated group: %s", data)
+	}
+}
+
+func TestRunGroupFile(t *testing.T) {
+	dir := t.TempDir()
+	groupFile := filepath.Join(dir, "group.json")
+	group := `{"p":"1031","known_root":"14","order_factors":["2","5","103"]}`
+	if err := os.WriteFile(groupFile, []byte(group), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := filepath.Join(dir, "state.json")
+	var out bytes.Buffer
+	if err := run([]string{"-e", "3", "--group-file", groupFile, "--checkpoint-file", checkpoint, "10.0.0.0/22"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(nonEmptyLines(out.String())); got != 1024 {
+		t.Fatalf("got %d targets, want 1024", got)
+	}
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"prime":"1031"`) {
+		t.Fatalf("checkpoint does not use the group from the file: %s", data)
+	}
+
+	out.Reset()
+	if err := run([]string{"-e", "3", "--group-file", groupFile, "2001:db8::/118"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(nonEmptyLines(out.String())); got != 1024 {
+		t.Fatalf("got %d IPv6 targets, want 1024", got)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"p":"1031","known_root":"14","order_factors":["2","5"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"--group-file", bad, "10.0.0.0/22"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for a group with incomplete factors")
+	}
+}
+
+func TestRunSeedVersion(t *testing.T) {
+	outputs := make(map[string]string)
+	for _, version := range []string{"1", "mathrand"} {
+		var out bytes.Buffer
+		if err := run([]string{"-e", "7", "-n", "5", "--seed-version", version, "10.0.0.0/16"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		outputs[version] = out.String()
+	}
+	var defaultOut bytes.Buffer
+	if err := run([]string{"-e", "7", "-n", "5", "10.0.0.0/16"}, &defaultOut); err != nil {
+		t.Fatal(err)
+	}
+	if defaultOut.String() != outputs["1"] {
+		t.Fatal("default seed version is not version 1")
+	}
+	if outputs["1"] == outputs["mathrand"] {
+		t.Fatal("seed versions produced the same ordering")
+	}
+	if err := run([]string{"-e", "7", "--seed-version", "9", "10.0.0.0/16"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unknown seed version")
+	}
+}
+
+func TestRunFeistelOrdering(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, shard := range []string{"0", "1"} {
+		var out bytes.Buffer
+		if err := run([]string{"-e", "2", "--ordering", "feistel", "--shards", "2", "--shard", shard, "--shard-mode", "cycle", "10.0.0.0/24"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range nonEmptyLines(out.String()) {
+			if seen[line] {
+				t.Fatalf("%s emitted twice", line)
+			}
+			seen[line] = true
+		}
+	}
+	if len(seen) != 256 {
+		t.Fatalf("got %d targets, want 256", len(seen))
+	}
+	if err := run([]string{"--ordering", "feistel", "--checkpoint-file", filepath.Join(t.TempDir(), "cp"), "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error combining the Feistel ordering with checkpoints")
+	}
+}
+
+func TestRunLocate(t *testing.T) {
+	scan := []string{"-e", "3", "-p", "80,443", "--shards", "2", "--shard", "1", "10.0.0.0/24"}
+	var out bytes.Buffer
+	if err := run(scan, &out); err != nil {
+		t.Fatal(err)
+	}
+	targets := nonEmptyLines(out.String())[:5]
+	args := []string{"locate"}
+	for _, target := range targets {
+		args = append(args, "--target", target)
+	}
+	out.Reset()
+	if err := run(append(args, scan...), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := nonEmptyLines(out.String())
+	if len(lines) != len(targets) {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), len(targets), lines)
+	}
+	previous := -1
+	for i, line := range lines {
+		var target string
+		var cycleIndex, index, shard int
+		if _, err := fmt.Sscanf(line, "%s cycle_index=%d index=%d shard=%d", &target, &cycleIndex, &index, &shard); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if target != targets[i] || shard != 1 || cycleIndex <= previous {
+			t.Fatalf("line %d = %q, want target %s in shard 1 after cycle index %d", i, line, targets[i], previous)
+		}
+		previous = cycleIndex
+	}
+
+	if err := run([]string{"locate", "--target", "10.1.0.1,80", "-p", "80", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error locating a target that is not allowed")
+	}
+	if err := run([]string{"locate", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error when no target is given")
+	}
+	if err := run([]string{"locate", "--target", "10.0.0.1:80", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for a malformed target")
+	}
+}
+
+func TestRunRanges(t *testing.T) {
+	args := []string{"10.0.0.0/24", "10.0.1.7", "192.0.2.0/25", "192.0.2.128/25"}
+	var out bytes.Buffer
+	if err := run(append([]string{"ranges"}, args...), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "10.0.0.0-10.0.0.255\n10.0.1.7\n192.0.2.0-192.0.2.255\n"; got != want {
+		t.Fatalf("ranges output = %q, want %q", got, want)
+	}
+
+	dir := t.TempDir()
+	blocklist := filepath.Join(dir, "block.txt")
+	if err := os.WriteFile(blocklist, []byte("10.0.0.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run(append([]string{"ranges", "--cidr", "-b", blocklist}, args...), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "10.0.0.0/32\n10.0.0.2/31\n10.0.0.4/30\n10.0.0.8/29\n10.0.0.16/28\n10.0.0.32/27\n10.0.0.64/26\n10.0.0.128/25\n10.0.1.7/32\n192.0.2.0/24\n"
+	if got := out.String(); got != want {
+		t.Fatalf("ranges --cidr output = %q, want %q", got, want)
+	}
+
+	if err := run([]string{"ranges", "2001:db8::/64"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error listing IPv6 ranges")
+	}
+	if err := run([]string{"--cidr", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for --cidr outside the ranges subcommand")
+	}
+}
+
+func TestRunExcludePreset(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"ranges", "--cidr", "--exclude-preset", "private", "--exclude-preset", "documentation,multicast", "10.0.0.0/7", "192.0.2.0/23", "224.0.0.0/3"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "11.0.0.0/8\n192.0.3.0/24\n240.0.0.0/4\n"; got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+	if err := run([]string{"--exclude-preset", "public", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for an unknown preset")
+	}
+	if err := run([]string{"--exclude-preset", "private", "2001:db8::/120"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error excluding presets from IPv6 targets")
+	}
+}
+
+func TestRunRangeSyntax(t *testing.T) {
+	dir := t.TempDir()
+	allowlist := filepath.Join(dir, "allow.txt")
+	if err := os.WriteFile(allowlist, []byte("10.0.0.4-10.0.0.7\n10.0.1.0 255.255.255.252\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"ranges", "--cidr", "-w", allowlist}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "10.0.0.4/30\n10.0.1.0/30\n"; got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(allowlist, []byte("10.0.0.0/24\nlocalhost.invalid\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := run([]string{"ranges", "-w", allowlist}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), allowlist+":2:") {
+		t.Fatalf("error = %v, want one naming line 2 of %s", err, allowlist)
+	}
+}
+
+func TestRunStrictAndLenient(t *testing.T) {
+	allowlist := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(allowlist, []byte("10.0.0.0/30\n10.0.0.300\n10.0.1.0/30\nbad entry\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"-w", allowlist}, {"--strict", "-w", allowlist}} {
+		err := run(args, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), allowlist+":2:1:") || !strings.Contains(err.Error(), allowlist+":4:1:") {
+			t.Fatalf("%v: error = %v, want both invalid lines", args, err)
+		}
+	}
+
+	var warnings bytes.Buffer
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = &warnings
+	var out bytes.Buffer
+	if err := run([]string{"ranges", "--lenient", "-w", allowlist}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "10.0.0.0-10.0.0.3\n10.0.1.0-10.0.1.3\n"; got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+	lines := nonEmptyLines(warnings.String())
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "warning: skipping "+allowlist+":2:1:") {
+		t.Fatalf("warnings = %q, want one per invalid line", lines)
+	}
+
+	if err := run([]string{"--strict", "--lenient", "10.0.0.0/24"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error combining --strict and --lenient")
+	}
+}
+
+func TestRunLabels(t *testing.T) {
+	allowlist := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(allowlist, []byte("10.0.0.0/31 customer-a\n10.0.1.0/31 # customer-b\n10.0.2.0 customer c, inc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"-e", "1", "--labels", "-p", "80", "-w", allowlist}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := nonEmptyLines(out.String())
+	sort.Strings(got)
+	want := []string{"10.0.0.0,80,customer-a", "10.0.0.1,80,customer-a", "10.0.1.0,80,customer-b", "10.0.1.1,80,customer-b", `10.0.2.0,80,"customer c, inc"`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+	if err := run([]string{"--labels", "--output-format", "binary", "-w", allowlist}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error combining --labels with binary output")
+	}
+}
+
+func TestRunStratify(t *testing.T) {
+	args := []string{"-e", "3", "--stratify", "-n", "20", "--min-per-range", "5", "10.0.0.0/16", "192.0.2.0/30"}
+	var out bytes.Buffer
+	if err := run(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := nonEmptyLines(out.String())
+	if len(got) != 20 {
+		t.Fatalf("sampled %d targets, want 20", len(got))
+	}
+	small := 0
+	for _, line := range got {
+		if strings.HasPrefix(line, "192.0.2.") {
+			small++
+		}
+	}
+	if small != 4 {
+		t.Fatalf("sampled %d targets from 192.0.2.0/30, want all 4", small)
+	}
+	var again bytes.Buffer
+	if err := run(args, &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != out.String() {
+		t.Fatal("the same seed sampled different targets")
+	}
+
+	// Adjacent lines are still sampled separately.
+	out.Reset()
+	if err := run([]string{"-e", "3", "--stratify", "-n", "6", "--min-per-range", "2", "10.0.0.0/16", "10.1.0.0/30", "192.168.0.1"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	adjacent := 0
+	for _, line := range nonEmptyLines(out.String()) {
+		if strings.HasPrefix(line, "10.1.0.") {
+			adjacent++
+		}
+	}
+	if adjacent != 2 {
+		t.Fatalf("sampled %d targets from 10.1.0.0/30, want 2", adjacent)
+	}
+
+	out.Reset()
+	if err := run([]string{"-e", "3", "--stratify", "-n", "10", "--range-weights", "0,1", "10.0.0.0/16", "192.0.2.0/28"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range nonEmptyLines(out.String()) {
+		if !strings.HasPrefix(line, "192.0.2.") {
+			t.Fatalf("sampled %s from a range with weight 0", line)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--stratify", "10.0.0.0/24"},
+		{"--min-per-range", "2", "-n", "5", "10.0.0.0/24"},
+		{"--stratify", "-n", "5", "--range-weights", "x", "10.0.0.0/24"},
+		{"--stratify", "-n", "5", "--range-weights", "1,2", "10.0.0.0/24"},
+		{"-e", "1", "--stratify", "-n", "5", "--shards", "2", "--shard-mode", "cycle", "10.0.0.0/24"},
+		{"--stratify", "-n", "5", "2001:db8::/120"},
+	} {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Fatalf("run(%q) succeeded", args)
+		}
+	}
+}
+
+func TestRunRate(t *testing.T) {
+	var want bytes.Buffer
+	if err := run([]string{"-e", "8", "10.0.0.0/27"}, &want); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-e", "8", "--rate", "1000000", "10.0.0.0/27"},
+		{"-e", "8", "-B", "10G", "10.0.0.0/27"},
+	} {
+		var out bytes.Buffer
+		if err := run(args, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want.String() {
+			t.Fatalf("run(%q) changed the output", args)
+		}
+	}
+	var out bytes.Buffer
+	if err := run([]string{"-e", "8", "--rate", "1000000", "--threads", "2", "--shard-mode", "cycle", "10.0.0.0/27"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(nonEmptyLines(out.String())); got != 32 {
+		t.Fatalf("threads wrote %d targets, want 32", got)
+	}
+
+	// 20 targets at 200 per second, one at a time, take at least 95ms.
+	start := time.Now()
+	if err := run([]string{"-n", "20", "--rate", "200", "--burst", "1", "10.0.0.0/24"}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 95*time.Millisecond {
+		t.Fatalf("20 targets at 200 per second took %v", elapsed)
+	}
+
+	for _, args := range [][]string{
+		{"--rate", "10", "--bandwidth", "1M", "10.0.0.0/24"},
+		{"--bandwidth", "fast", "10.0.0.0/24"},
+		{"--bandwidth", "0", "10.0.0.0/24"},
+		{"--rate", "10", "2001:db8::/120"},
+	} {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Fatalf("run(%q) succeeded", args)
+		}
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := map[string]float64{
+		"1500": 1500,
+		"10k":  10e3,
+		"10M":  10e6,
+		"2G":   2e9,
+	}
+	for def, want := range tests {
+		got, err := parseBandwidth(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("parseBandwidth(%q) = %v, want %v", def, got, want)
+		}
+	}
+	for _, def := range []string{"", "M", "1.5G", "-1", "10T"} {
+		if _, err := parseBandwidth(def); err == nil {
+			t.Fatalf("parseBandwidth(%q) succeeded", def)
+		}
+	}
+}
@@ -1,13 +1,13 @@
 package ziterate
 
 import (
-	"crypto/rand"
 	"fmt"
 	"io"
 	"math/big"
 )
 
 var zero = big.NewInt(0)
+var one = big.NewInt(1)
 var maxGenerator = big.NewInt(MaxGeneratorForSmallGroup)
 
 // Group represents a cyclic group module P. It can be used for additive or multiplicative groups.
@@ -27,7 +27,7 @@ func (g *Group) findMultiplicativeGenerator(random io.Reader) (*big.Int, error)
 	if limit.Cmp(maxGenerator) > 0 {
 		limit.Set(maxGenerator)
 	}
-	candidate, err := rand.Int(random, g.P)
+	candidate, err := randomBelow(random, g.P)
 	if err != nil {
 		return nil, err
 	}
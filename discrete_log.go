@@ -0,0 +1,119 @@
+package ziterate
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// maxDiscreteLogFactor bounds the largest prime factor of P - 1 that
+// discreteLog will handle. Baby-step giant-step needs a table of about
+// sqrt(factor) elements, so this caps the table at 2^22 entries.
+var maxDiscreteLogFactor = big.NewInt(1 << 44)
+
+// checkDiscreteLog returns an error unless every prime factor of the group
+// order is small enough for discreteLog.
+func (g *Group) checkDiscreteLog() error {
+	for _, q := range g.OrderFactors {
+		if q.Cmp(maxDiscreteLogFactor) > 0 {
+			return fmt.Errorf("factor %s of the group order is too large to compute discrete logarithms", q)
+		}
+	}
+	return nil
+}
+
+// discreteLog returns the x in [0, P - 1) with base^x = h mod P, where base is
+// a generator of the multiplicative group. It uses the Pohlig-Hellman
+// algorithm with the order factors of the group, so its cost is governed by
+// the largest prime factor of P - 1.
+func (g *Group) discreteLog(base, h *big.Int) (*big.Int, error) {
+	if h.Sign() <= 0 || h.Cmp(g.P) >= 0 {
+		return nil, fmt.Errorf("%s is not an element of the group modulo %s", h, g.P)
+	}
+	if err := g.checkDiscreteLog(); err != nil {
+		return nil, err
+	}
+	order := big.NewInt(0).Sub(g.P, one)
+	x := big.NewInt(0)
+	modulus := big.NewInt(1)
+	for _, q := range g.OrderFactors {
+		if big.NewInt(0).Mod(modulus, q).Sign() == 0 {
+			// A repeated factor, already solved for.
+			continue
+		}
+		// Find the exponent e of q in the order, and x mod q^e.
+		qe := big.NewInt(1)
+		for big.NewInt(0).Mod(order, big.NewInt(0).Mul(qe, q)).Sign() == 0 {
+			qe.Mul(qe, q)
+		}
+		xq, err := g.discreteLogPrimePower(base, h, q, qe, order)
+		if err != nil {
+			return nil, err
+		}
+		// Combine with the residues found so far by the Chinese remainder
+		// theorem.
+		inverse := big.NewInt(0).ModInverse(modulus, qe)
+		t := big.NewInt(0).Sub(xq, x)
+		t.Mul(t, inverse)
+		t.Mod(t, qe)
+		x.Add(x, t.Mul(t, modulus))
+		modulus.Mul(modulus, qe)
+	}
+	return x.Mod(x, order), nil
+}
+
+// discreteLogPrimePower returns x mod q^e, where qe = q^e exactly divides the
+// group order, one base-q digit at a time.
+func (g *Group) discreteLogPrimePower(base, h, q, qe, order *big.Int) (*big.Int, error) {
+	gamma := big.NewInt(0).Exp(base, big.NewInt(0).Div(order, q), g.P)
+	baseInverse := big.NewInt(0).ModInverse(base, g.P)
+	x := big.NewInt(0)
+	qk := big.NewInt(1)
+	for qk.Cmp(qe) < 0 {
+		// hk = (base^-x * h)^(order / q^(k+1)) has order q.
+		hk := big.NewInt(0).Exp(baseInverse, x, g.P)
+		hk.Mul(hk, h)
+		hk.Mod(hk, g.P)
+		exponent := big.NewInt(0).Div(order, big.NewInt(0).Mul(qk, q))
+		hk.Exp(hk, exponent, g.P)
+		digit, err := g.babyStepGiantStep(gamma, hk, q)
+		if err != nil {
+			return nil, err
+		}
+		x.Add(x, digit.Mul(digit, qk))
+		qk.Mul(qk, q)
+	}
+	return x, nil
+}
+
+// babyStepGiantStep returns the d in [0, q) with gamma^d = h mod P, where gamma
+// has prime order q.
+func (g *Group) babyStepGiantStep(gamma, h, q *big.Int) (*big.Int, error) {
+	m := big.NewInt(0).Sqrt(q)
+	m.Add(m, one)
+	steps := m.Uint64()
+	table := make(map[string]uint64, steps)
+	current := big.NewInt(1)
+	for j := uint64(0); j < steps; j++ {
+		key := string(current.Bytes())
+		if _, ok := table[key]; !ok {
+			table[key] = j
+		}
+		current.Mul(current, gamma)
+		current.Mod(current, g.P)
+	}
+	// giant is gamma^-m.
+	giant := big.NewInt(0).Exp(gamma, m, g.P)
+	giant.ModInverse(giant, g.P)
+	current.Set(h)
+	for i := uint64(0); i < steps; i++ {
+		if j, ok := table[string(current.Bytes())]; ok {
+			d := big.NewInt(0).SetUint64(i)
+			d.Mul(d, m)
+			d.Add(d, big.NewInt(0).SetUint64(j))
+			return d.Mod(d, q), nil
+		}
+		current.Mul(current, giant)
+		current.Mod(current, g.P)
+	}
+	return nil, fmt.Errorf("no discrete logarithm of %s base %s modulo %s: the group order factors are incomplete", h, gamma, g.P)
+}
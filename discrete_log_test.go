@@ -0,0 +1,75 @@
+package ziterate
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDiscreteLog(t *testing.T) {
+	random := NewSeedReader(16)
+	for _, g := range ZMapGroups {
+		if g.checkDiscreteLog() != nil {
+			continue
+		}
+		base, err := g.findMultiplicativeGenerator(random)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order := big.NewInt(0).Sub(g.P, one)
+		x, err := randomBelow(random, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []*big.Int{
+			big.NewInt(0),
+			big.NewInt(1),
+			big.NewInt(0).Sub(order, one),
+			x,
+		} {
+			h := big.NewInt(0).Exp(base, want, g.P)
+			got, err := g.discreteLog(base, h)
+			if err != nil {
+				t.Fatalf("P=%s: discreteLog(%s, %s) returned error: %v", g.P, base, h, err)
+			}
+			if got.Cmp(want) != 0 {
+				t.Fatalf("P=%s: discreteLog(%s, %s) = %s, want %s", g.P, base, h, got, want)
+			}
+		}
+	}
+}
+
+func TestDiscreteLogRepeatedFactors(t *testing.T) {
+	// 257 - 1 = 2^8, and the factor may be listed more than once.
+	g := &Group{P: big.NewInt(257), KnownRoot: big.NewInt(3), OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(2)}}
+	for x := int64(0); x < 256; x++ {
+		h := big.NewInt(0).Exp(g.KnownRoot, big.NewInt(x), g.P)
+		got, err := g.discreteLog(g.KnownRoot, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Int64() != x {
+			t.Fatalf("discreteLog(3, %s) = %s, want %d", h, got, x)
+		}
+	}
+}
+
+func TestDiscreteLogFactorTooLarge(t *testing.T) {
+	g, err := SmallestZMapGroupForBigInt(big.NewInt(0).Lsh(one, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.discreteLog(g.KnownRoot, big.NewInt(2))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("discreteLog() error = %v, want factor too large", err)
+	}
+}
+
+func TestDiscreteLogNotAnElement(t *testing.T) {
+	g := ZMapGroups[0]
+	for _, h := range []*big.Int{big.NewInt(0), g.P} {
+		if _, err := g.discreteLog(g.KnownRoot, h); err == nil {
+			t.Fatalf("discreteLog(%s) returned nil error", h)
+		}
+	}
+}
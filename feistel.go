@@ -0,0 +1,149 @@
+package ziterate
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// feistelRounds is the number of rounds in a FeistelIterator's network.
+const feistelRounds = 6
+
+// FeistelIterator walks a pseudorandom permutation of [1, n], built from a
+// balanced Feistel network over the smallest even number of bits that covers
+// n. Outputs of the network that fall outside the range are fed back through
+// it, a technique known as cycle walking, so the permutation covers exactly n
+// elements. Unlike a cyclic group, which needs a prime larger than n and skips
+// the elements above n, it never walks more than n positions, and each
+// position takes fewer than four evaluations of the network on average.
+//
+// The permutation is keyed by round keys read from the random source. Like
+// the group iterators, elements are numbered from 1 so that 0 can signal the
+// end of iteration.
+type FeistelIterator struct {
+	n        uint64
+	halfBits uint
+	mask     uint64
+	keys     [feistelRounds]uint64
+	position uint64
+	stop     uint64
+}
+
+// NewFeistelIterator constructs a FeistelIterator over [1, n], keyed with
+// bytes read from random.
+func NewFeistelIterator(n uint64, random io.Reader) (*FeistelIterator, error) {
+	if n == 0 {
+		return nil, fmt.Errorf("cannot permute an empty range")
+	}
+	width := uint(bits.Len64(n - 1))
+	width += width % 2
+	width = max(width, 2)
+	it := &FeistelIterator{
+		n:        n,
+		halfBits: width / 2,
+		mask:     1<<(width/2) - 1,
+		stop:     n,
+	}
+	var buf [8 * feistelRounds]byte
+	if _, err := io.ReadFull(random, buf[:]); err != nil {
+		return nil, err
+	}
+	for i := range it.keys {
+		it.keys[i] = binary.LittleEndian.Uint64(buf[8*i:])
+	}
+	return it, nil
+}
+
+// NextUint returns the next element of the permutation, or 0 once the
+// iterator has walked all of it.
+func (it *FeistelIterator) NextUint() uint64 {
+	if it.position >= it.stop {
+		return 0
+	}
+	x := it.permute(it.position)
+	it.position++
+	return x + 1
+}
+
+// permute maps x in [0, n) to its image under the permutation.
+func (it *FeistelIterator) permute(x uint64) uint64 {
+	for {
+		x = it.feistel(x)
+		if x < it.n {
+			return x
+		}
+	}
+}
+
+// feistel applies the network once, permuting [0, 2^(2*halfBits)).
+func (it *FeistelIterator) feistel(x uint64) uint64 {
+	left, right := x>>it.halfBits, x&it.mask
+	for _, key := range it.keys {
+		left, right = right, left^(feistelRound(right, key)&it.mask)
+	}
+	return left<<it.halfBits | right
+}
+
+// inverse maps y in [0, n) to the x with permute(x) = y.
+func (it *FeistelIterator) inverse(y uint64) uint64 {
+	for {
+		y = it.feistelInverse(y)
+		if y < it.n {
+			return y
+		}
+	}
+}
+
+// feistelInverse undoes feistel.
+func (it *FeistelIterator) feistelInverse(y uint64) uint64 {
+	left, right := y>>it.halfBits, y&it.mask
+	for i := len(it.keys) - 1; i >= 0; i-- {
+		left, right = right^(feistelRound(left, it.keys[i])&it.mask), left
+	}
+	return left<<it.halfBits | right
+}
+
+// feistelRound is the round function: the SplitMix64 finalizer applied to the
+// half block combined with the round key.
+func feistelRound(x, key uint64) uint64 {
+	z := x ^ key
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// Seek positions the iterator so that the next element returned is the one at
+// position k of the permutation. Seeking to or beyond the end completes the
+// iterator.
+func (it *FeistelIterator) Seek(k uint64) {
+	it.position = min(k, it.stop)
+}
+
+// Skip advances the iterator by n elements without returning them.
+func (it *FeistelIterator) Skip(n uint64) {
+	k, carry := bits.Add64(it.position, n, 0)
+	if carry != 0 {
+		k = math.MaxUint64
+	}
+	it.Seek(k)
+}
+
+// Position returns the number of elements the iterator has moved through
+// since the start of the permutation.
+func (it *FeistelIterator) Position() uint64 {
+	return it.position
+}
+
+// limit ends the permutation after position stop instead of after n.
+func (it *FeistelIterator) limit(stop uint64) {
+	it.stop = min(stop, it.n)
+	it.position = min(it.position, it.stop)
+}
+
+// clone returns an independent copy of the iterator.
+func (it *FeistelIterator) clone() *FeistelIterator {
+	out := *it
+	return &out
+}
@@ -0,0 +1,283 @@
+package ziterate
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeistelIteratorIsPermutation(t *testing.T) {
+	for _, n := range []uint64{1, 2, 3, 5, 16, 17, 1000, 4097, 65536, 100003} {
+		it, err := NewFeistelIterator(n, NewSeedReader(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make([]bool, n+1)
+		count := uint64(0)
+		for x := it.NextUint(); x != 0; x = it.NextUint() {
+			if x > n {
+				t.Fatalf("n=%d: element %d is out of range", n, x)
+			}
+			if seen[x] {
+				t.Fatalf("n=%d: duplicate element %d", n, x)
+			}
+			seen[x] = true
+			count++
+		}
+		if count != n {
+			t.Fatalf("n=%d: got %d elements", n, count)
+		}
+		if it.Position() != n {
+			t.Fatalf("n=%d: Position() = %d at the end", n, it.Position())
+		}
+	}
+	if _, err := NewFeistelIterator(0, NewSeedReader(1)); err == nil {
+		t.Fatal("expected error for an empty range")
+	}
+}
+
+func TestFeistelIteratorLargeRange(t *testing.T) {
+	it, err := NewFeistelIterator(math.MaxUint64, NewSeedReader(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 1000; i++ {
+		x := it.NextUint()
+		if x == 0 || seen[x] {
+			t.Fatalf("bad element %d at position %d", x, i)
+		}
+		seen[x] = true
+	}
+}
+
+func TestFeistelIteratorSeekAndSkip(t *testing.T) {
+	const n = 5000
+	it, err := NewFeistelIterator(n, NewSeedReader(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sequence []uint64
+	for x := range uintSeq(it) {
+		sequence = append(sequence, x)
+	}
+	seeker, err := NewFeistelIterator(n, NewSeedReader(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []uint64{0, 1, 4999, 17, 2500} {
+		seeker.Seek(k)
+		if got := seeker.NextUint(); got != sequence[k] {
+			t.Fatalf("element after Seek(%d) = %d, want %d", k, got, sequence[k])
+		}
+	}
+	seeker.Seek(100)
+	seeker.Skip(50)
+	if got := seeker.NextUint(); got != sequence[150] {
+		t.Fatalf("element after Skip = %d, want %d", got, sequence[150])
+	}
+	seeker.Skip(math.MaxUint64)
+	if got := seeker.NextUint(); got != 0 {
+		t.Fatalf("element after skipping past the end = %d, want 0", got)
+	}
+	seeker.Seek(10)
+	seeker.limit(12)
+	if a, b, c := seeker.NextUint(), seeker.NextUint(), seeker.NextUint(); a != sequence[10] || b != sequence[11] || c != 0 {
+		t.Fatalf("limited iteration returned %d, %d, %d", a, b, c)
+	}
+}
+
+// uintSeq ranges over the remaining elements of a UintIterator.
+func uintSeq(it UintIterator) func(func(uint64) bool) {
+	return func(yield func(uint64) bool) {
+		for x := it.NextUint(); x != 0; x = it.NextUint() {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+func TestTargetIteratorFeistelOrdering(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/20", "10.1.0.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := TargetPorts{Ports: []uint16{80, 443}, IncludePort: true}
+	targets := allowed.Count() * 2
+	seen := make(map[Target]bool)
+	for _, shard := range []uint16{0, 1, 2} {
+		it, err := NewTargetIterator(TargetIteratorOptions{
+			Allowed:  allowed,
+			Ports:    ports,
+			Random:   NewSeedReader(4),
+			Shard:    shard,
+			Shards:   3,
+			Sharding: ShardByCycle,
+			Ordering: OrderByFeistel,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts, err := it.Split(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range parts {
+			for target := range part.All() {
+				if seen[target] {
+					t.Fatalf("duplicate target %+v", target)
+				}
+				seen[target] = true
+			}
+		}
+	}
+	if uint64(len(seen)) != targets {
+		t.Fatalf("got %d targets, want %d", len(seen), targets)
+	}
+
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(4), Ordering: OrderByFeistel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first []Target
+	for target := range it.All() {
+		first = append(first, target)
+		if len(first) == 10 {
+			break
+		}
+	}
+	if err := it.Seek(3); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := it.Next(); got != first[3] {
+		t.Fatalf("target after Seek(3) = %+v, want %+v", got, first[3])
+	}
+	if _, err := it.Checkpoint(); err == nil {
+		t.Fatal("expected error checkpointing a Feistel ordering")
+	}
+
+	_, err = NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(4), Ordering: OrderByFeistel, Group: ZMapGroups[3]})
+	if err == nil {
+		t.Fatal("expected error combining a group with the Feistel ordering")
+	}
+	_, err = NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(4), Ordering: Ordering(9)})
+	if err == nil {
+		t.Fatal("expected error for an unknown ordering")
+	}
+}
+
+func TestParseOrdering(t *testing.T) {
+	for _, o := range []Ordering{OrderByGroup, OrderByFeistel} {
+		got, err := ParseOrdering(o.String())
+		if err != nil || got != o {
+			t.Fatalf("ParseOrdering(%q) = %v, %v", o.String(), got, err)
+		}
+	}
+	if _, err := ParseOrdering("random"); err == nil {
+		t.Fatal("expected error for unknown ordering")
+	}
+}
+
+// orderingStats summarizes how an ordering of n target indexes behaves.
+type orderingStats struct {
+	// walked is the number of positions walked to emit every target.
+	walked uint64
+	// chiSquare measures how evenly each tenth of the output is spread across
+	// sixteen equal buckets of the target space.
+	chiSquare float64
+	// adjacent is the fraction of consecutive outputs that are neighbouring
+	// indexes.
+	adjacent float64
+}
+
+func measureOrdering(t *testing.T, it *TargetIterator, n uint64) orderingStats {
+	t.Helper()
+	const chunks, buckets = 10, 16
+	var indexes []uint64
+	for record, ok := it.NextRecord(); ok; record, ok = it.NextRecord() {
+		indexes = append(indexes, record.Index)
+	}
+	if uint64(len(indexes)) != n {
+		t.Fatalf("got %d targets, want %d", len(indexes), n)
+	}
+	var stats orderingStats
+	stats.walked, _ = it.Position()
+	chunkSize := len(indexes) / chunks
+	for c := 0; c < chunks; c++ {
+		var counts [buckets]float64
+		for _, index := range indexes[c*chunkSize : (c+1)*chunkSize] {
+			counts[index*buckets/n]++
+		}
+		expected := float64(chunkSize) / buckets
+		for _, count := range counts {
+			stats.chiSquare += (count - expected) * (count - expected) / expected
+		}
+	}
+	adjacent := 0
+	for i := 1; i < len(indexes); i++ {
+		if indexes[i] == indexes[i-1]+1 || indexes[i]+1 == indexes[i-1] {
+			adjacent++
+		}
+	}
+	stats.adjacent = float64(adjacent) / float64(len(indexes)-1)
+	return stats
+}
+
+// TestFeistelOrderingComparedToGroup compares the Feistel ordering with the
+// group ordering on a target space far below the next ZMap prime, where the
+// group walk wastes almost all of its elements.
+func TestFeistelOrderingComparedToGroup(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/15"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := allowed.Count()
+	results := make(map[Ordering]orderingStats)
+	for _, ordering := range []Ordering{OrderByGroup, OrderByFeistel} {
+		it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(21), Ordering: ordering})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := measureOrdering(t, it, n)
+		t.Logf("%-7s walked %9d positions for %d targets, chi-square %6.1f over 150 degrees of freedom, %.5f adjacent",
+			ordering, stats.walked, n, stats.chiSquare, stats.adjacent)
+		// The 99.9th percentile of a chi-square distribution with 150 degrees
+		// of freedom is about 215.
+		if stats.chiSquare > 215 {
+			t.Errorf("%s ordering is unevenly spread: chi-square %.1f", ordering, stats.chiSquare)
+		}
+		if stats.adjacent > 0.001 {
+			t.Errorf("%s ordering emits %.5f of targets next to the previous one", ordering, stats.adjacent)
+		}
+		results[ordering] = stats
+	}
+	if got := results[OrderByFeistel].walked; got != n {
+		t.Errorf("Feistel ordering walked %d positions, want %d", got, n)
+	}
+	if results[OrderByGroup].walked < 100*n {
+		t.Errorf("group ordering walked only %d positions for %d targets", results[OrderByGroup].walked, n)
+	}
+}
+
+func benchmarkOrdering(b *testing.B, ordering Ordering) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/15"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(uint64(i)), Ordering: ordering})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range it.All() {
+		}
+	}
+}
+
+func BenchmarkTargetIteratorGroupOrderingSmallSpace(b *testing.B) {
+	benchmarkOrdering(b, OrderByGroup)
+}
+
+func BenchmarkTargetIteratorFeistelOrderingSmallSpace(b *testing.B) {
+	benchmarkOrdering(b, OrderByFeistel)
+}
@@ -0,0 +1,143 @@
+package ziterate
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"slices"
+)
+
+// GenerateGroup returns a cyclic group whose prime P is the smallest prime
+// greater than both n and 2, so that a target space of n elements wastes as
+// few elements of the cycle as possible. P - 1 is fully factored, and
+// KnownRoot is the smallest primitive root modulo P. The group depends only
+// on n: random only seeds the factoring of P - 1, and may be nil to use
+// crypto/rand.
+func GenerateGroup(n uint64, random io.Reader) (*Group, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	p, ok := nextPrime(max(n, 2))
+	if !ok {
+		return nil, fmt.Errorf("no prime greater than %d fits in a uint64", n)
+	}
+	factors, err := factorUint64(p-1, random)
+	if err != nil {
+		return nil, err
+	}
+	g := &Group{P: big.NewInt(0).SetUint64(p)}
+	for _, f := range factors {
+		g.OrderFactors = append(g.OrderFactors, big.NewInt(0).SetUint64(f))
+	}
+	for root := uint64(2); root < p; root++ {
+		candidate := big.NewInt(0).SetUint64(root)
+		if g.checkIfMultiplicativeGenerator(candidate) == nil {
+			g.KnownRoot = candidate
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find a primitive root modulo %d", p)
+}
+
+// nextPrime returns the smallest prime greater than n.
+func nextPrime(n uint64) (uint64, bool) {
+	for p := n + 1; p > n; p++ {
+		if isPrimeUint64(p) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// isPrimeUint64 reports whether n is prime. ProbablyPrime is exact for inputs
+// below 2^64.
+func isPrimeUint64(n uint64) bool {
+	return big.NewInt(0).SetUint64(n).ProbablyPrime(0)
+}
+
+// smallPrimes are removed by trial division before falling back to Pollard's
+// rho.
+var smallPrimes = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47}
+
+// factorUint64 returns the distinct prime factors of n in ascending order.
+func factorUint64(n uint64, random io.Reader) ([]uint64, error) {
+	var factors []uint64
+	for _, p := range smallPrimes {
+		if n%p == 0 {
+			factors = append(factors, p)
+			for n%p == 0 {
+				n /= p
+			}
+		}
+	}
+	pending := []uint64{}
+	if n > 1 {
+		pending = append(pending, n)
+	}
+	for len(pending) > 0 {
+		m := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if isPrimeUint64(m) {
+			if !slices.Contains(factors, m) {
+				factors = append(factors, m)
+			}
+			continue
+		}
+		d, err := pollardRho(m, random)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, d, m/d)
+	}
+	slices.Sort(factors)
+	return factors, nil
+}
+
+// pollardRho returns a non-trivial divisor of the composite n, using Brent's
+// variant of Pollard's rho with random starting points.
+func pollardRho(n uint64, random io.Reader) (uint64, error) {
+	var buf [16]byte
+	for {
+		if _, err := io.ReadFull(random, buf[:]); err != nil {
+			return 0, err
+		}
+		y := binary.LittleEndian.Uint64(buf[:8]) % n
+		c := binary.LittleEndian.Uint64(buf[8:])%(n-1) + 1
+		step := func(x uint64) uint64 {
+			sum, carry := bits.Add64(mulMod(x, x, n), c, 0)
+			if carry != 0 || sum >= n {
+				sum -= n
+			}
+			return sum
+		}
+		d := uint64(1)
+		for r := uint64(1); d == 1 && r < math.MaxUint32; r <<= 1 {
+			x := y
+			for i := uint64(0); i < r && d == 1; i++ {
+				y = step(y)
+				d = gcdUint64(absDiff(x, y), n)
+			}
+		}
+		if d != 1 && d != n {
+			return d, nil
+		}
+	}
+}
+
+func absDiff(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func gcdUint64(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
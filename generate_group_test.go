@@ -0,0 +1,140 @@
+package ziterate
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+// checkFullyFactored checks that factors are exactly the distinct prime
+// factors of n.
+func checkFullyFactored(t *testing.T, n uint64, factors []*big.Int) {
+	t.Helper()
+	rest := n
+	for _, f := range factors {
+		if !f.IsUint64() || !isPrimeUint64(f.Uint64()) {
+			t.Fatalf("factor %s of %d is not prime", f, n)
+		}
+		if rest%f.Uint64() != 0 {
+			t.Fatalf("%s does not divide %d", f, n)
+		}
+		for rest%f.Uint64() == 0 {
+			rest /= f.Uint64()
+		}
+	}
+	if rest != 1 {
+		t.Fatalf("factors %v of %d leave %d unfactored", factors, n, rest)
+	}
+}
+
+func TestGenerateGroup(t *testing.T) {
+	for _, n := range []uint64{
+		0, 1, 2, 256, 257, 1000, 1 << 24, 1<<32 - 1, 1 << 32, 1<<40 + 17,
+		281474976710677, 1 << 62, math.MaxUint64 - 100,
+	} {
+		g, err := GenerateGroup(n, NewSeedReader(n))
+		if err != nil {
+			t.Fatalf("GenerateGroup(%d): %v", n, err)
+		}
+		if err := g.IsValid(); err != nil {
+			t.Fatalf("GenerateGroup(%d) is invalid: %v", n, err)
+		}
+		p := g.P.Uint64()
+		if p <= n {
+			t.Fatalf("GenerateGroup(%d) prime %d is not greater than n", n, p)
+		}
+		for q := max(n, 2) + 1; q < p; q++ {
+			if isPrimeUint64(q) {
+				t.Fatalf("GenerateGroup(%d) prime %d skipped prime %d", n, p, q)
+			}
+		}
+		checkFullyFactored(t, p-1, g.OrderFactors)
+	}
+}
+
+func TestGenerateGroupIsDeterministic(t *testing.T) {
+	a, err := GenerateGroup(1<<50+3, NewSeedReader(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateGroup(1<<50+3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.P.Cmp(b.P) != 0 || a.KnownRoot.Cmp(b.KnownRoot) != 0 || len(a.OrderFactors) != len(b.OrderFactors) {
+		t.Fatalf("groups differ: %v and %v", a, b)
+	}
+}
+
+func TestGenerateGroupTooLarge(t *testing.T) {
+	if _, err := GenerateGroup(math.MaxUint64-58, nil); err == nil {
+		t.Fatal("expected error when no larger prime fits in a uint64")
+	}
+}
+
+func TestFactorUint64(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want []uint64
+	}{
+		{n: 2, want: []uint64{2}},
+		{n: 4294967310, want: []uint64{2, 3, 5, 131, 364289}},
+		{n: 17592186044422, want: []uint64{2, 11, 53, 97, 155542661}},
+		{n: 4294967291 * 4294967279, want: []uint64{4294967279, 4294967291}},
+		{n: 65521 * 65521 * 65521, want: []uint64{65521}},
+	}
+	for _, tc := range tests {
+		got, err := factorUint64(tc.n, NewSeedReader(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("factorUint64(%d) = %v, want %v", tc.n, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("factorUint64(%d) = %v, want %v", tc.n, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestTargetIteratorGeneratedGroup(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/22", "10.1.0.0/30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := GenerateGroup(allowed.Count(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.P.Uint64(), uint64(1031); got != want {
+		t.Fatalf("generated prime %d, want %d", got, want)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(6), Group: g})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint32]bool)
+	for target := range it.All() {
+		if seen[target.IP] {
+			t.Fatalf("duplicate target %#x", target.IP)
+		}
+		seen[target.IP] = true
+	}
+	if uint64(len(seen)) != allowed.Count() {
+		t.Fatalf("got %d targets, want %d", len(seen), allowed.Count())
+	}
+	position, err := it.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != g.P.Uint64()-1 {
+		t.Fatalf("walked %d elements, want %d", position, g.P.Uint64()-1)
+	}
+
+	_, err = NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(6), Group: ZMapGroups[0]})
+	if err == nil {
+		t.Fatal("expected error for a group smaller than the target space")
+	}
+}
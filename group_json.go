@@ -0,0 +1,119 @@
+package ziterate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// groupJSON is the JSON encoding of a Group. Numbers are decimal strings so
+// the encoding is exact for groups of any size.
+type groupJSON struct {
+	P            string   `json:"p"`
+	KnownRoot    string   `json:"known_root"`
+	OrderFactors []string `json:"order_factors"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (g *Group) MarshalJSON() ([]byte, error) {
+	if g.P == nil || g.KnownRoot == nil {
+		return nil, fmt.Errorf("group is missing P or KnownRoot")
+	}
+	out := groupJSON{
+		P:            g.P.String(),
+		KnownRoot:    g.KnownRoot.String(),
+		OrderFactors: make([]string, len(g.OrderFactors)),
+	}
+	for i, f := range g.OrderFactors {
+		out.OrderFactors[i] = f.String()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It rejects groups that do not
+// pass IsValid, or whose order factors are not exactly the prime factors of
+// P - 1.
+func (g *Group) UnmarshalJSON(data []byte) error {
+	var in groupJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	parse := func(name, s string) (*big.Int, error) {
+		n, ok := big.NewInt(0).SetString(s, 10)
+		if !ok || n.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid group %s: %q", name, s)
+		}
+		return n, nil
+	}
+	var out Group
+	var err error
+	if out.P, err = parse("p", in.P); err != nil {
+		return err
+	}
+	if out.KnownRoot, err = parse("known_root", in.KnownRoot); err != nil {
+		return err
+	}
+	for _, s := range in.OrderFactors {
+		f, err := parse("order factor", s)
+		if err != nil {
+			return err
+		}
+		out.OrderFactors = append(out.OrderFactors, f)
+	}
+	if err := out.checkOrderFactors(); err != nil {
+		return fmt.Errorf("invalid group: %w", err)
+	}
+	if err := out.IsValid(); err != nil {
+		return fmt.Errorf("invalid group: %w", err)
+	}
+	*g = out
+	return nil
+}
+
+// WriteTo writes the group as a single line of JSON.
+func (g *Group) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadGroup decodes a group written by WriteTo, and checks it as UnmarshalJSON
+// does.
+func ReadGroup(r io.Reader) (*Group, error) {
+	var g Group
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// checkOrderFactors checks that the order factors of a loaded group are primes
+// and include every prime factor of P - 1. IsValid only checks that they
+// divide P - 1, but a known root is only checked against the subgroups of the
+// listed factors, so a group from a file could otherwise have a root that does
+// not generate the whole group.
+func (g *Group) checkOrderFactors() error {
+	order := big.NewInt(0).Sub(g.P, one)
+	rest := big.NewInt(0).Set(order)
+	quotient, remainder := big.NewInt(0), big.NewInt(0)
+	for _, factor := range g.OrderFactors {
+		if !factor.ProbablyPrime(32) {
+			return fmt.Errorf("factor is not prime: %s", factor)
+		}
+		for {
+			quotient.QuoRem(rest, factor, remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			rest.Set(quotient)
+		}
+	}
+	if rest.Cmp(one) != 0 {
+		return fmt.Errorf("factors are incomplete: %s of the order %s is unfactored", rest, order)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package ziterate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGroupJSONRoundTrip(t *testing.T) {
+	for i, g := range ZMapGroups {
+		var buf bytes.Buffer
+		if _, err := g.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadGroup(&buf)
+		if err != nil {
+			t.Fatalf("group %d: %v", i, err)
+		}
+		if got.P.Cmp(g.P) != 0 || got.KnownRoot.Cmp(g.KnownRoot) != 0 || len(got.OrderFactors) != len(g.OrderFactors) {
+			t.Fatalf("group %d: got %+v, want %+v", i, got, g)
+		}
+		for j := range g.OrderFactors {
+			if got.OrderFactors[j].Cmp(g.OrderFactors[j]) != 0 {
+				t.Fatalf("group %d: factor %d is %s, want %s", i, j, got.OrderFactors[j], g.OrderFactors[j])
+			}
+		}
+	}
+}
+
+func TestGroupJSONFormat(t *testing.T) {
+	b, err := json.Marshal(ZMapGroups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"p":"257","known_root":"3","order_factors":["2"]}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// A Group nested in another value encodes the same way.
+	value, err := json.Marshal(struct{ Group *Group }{ZMapGroups[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(value), `{"Group":`+string(b)+`}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestReadGroupRejectsInvalidGroups(t *testing.T) {
+	for _, input := range []string{
+		`{"p":"4294967303","known_root":"3","order_factors":["2","3","5","131","364289"]}`,
+		`{"p":"4294967311","known_root":"30","order_factors":["2","3","5","131","364289"]}`,
+		`{"p":"4294967311","known_root":"3","order_factors":["2","3","5","131"]}`,
+		`{"p":"257","known_root":"3","order_factors":["2","4"]}`,
+		`{"p":"257","known_root":"three","order_factors":["2"]}`,
+		`{"p":"-257","known_root":"3","order_factors":["2"]}`,
+		`{"p":"257","order_factors":["2"]}`,
+		`{"p":"257",`,
+	} {
+		if _, err := ReadGroup(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error reading %s", input)
+		}
+	}
+}
+
+func TestTargetIteratorGroupFromJSON(t *testing.T) {
+	generated, err := GenerateGroup(1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := generated.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	g, err := ReadGroup(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/22"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(1), Group: g})
+	if err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Fatalf("expected error for a group smaller than the target space, got %v", err)
+	}
+}
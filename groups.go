@@ -6,6 +6,13 @@ import (
 )
 
 // ZMapGroups contains the cyclic groups used by ZMap, ordered by prime size.
+//
+// The groups up to 2^48 + 23 are the ones in ZMap. The larger groups, from
+// 2^52 + 21 to 2^128 + 51, extend the table for target spaces that ZMap cannot
+// iterate, such as IPv6 prefixes. Each of their primes is the smallest prime
+// greater than 2^k. P - 1 was factored with GNU factor, and every factor was
+// checked for primality. KnownRoot is the smallest primitive root modulo P.
+// TestZMapGroupsAreFullyFactored checks the table.
 var ZMapGroups = []*Group{
 	{
 		// 2^8 + 1
@@ -73,13 +80,82 @@ var ZMapGroups = []*Group{
 		KnownRoot:    big.NewInt(6),
 		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(7), big.NewInt(1361), big.NewInt(2462081249)},
 	},
+	{
+		// 2^52 + 21
+		P:            big.NewInt(4503599627370517),
+		KnownRoot:    big.NewInt(2),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(23), big.NewInt(612229), big.NewInt(987127)},
+	},
+	{
+		// 2^56 + 81
+		P:            big.NewInt(72057594037928017),
+		KnownRoot:    big.NewInt(10),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(7), big.NewInt(61), big.NewInt(34501), big.NewInt(14557303)},
+	},
+	{
+		// 2^60 + 33
+		P:            big.NewInt(1152921504606847009),
+		KnownRoot:    big.NewInt(13),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(11), big.NewInt(683), big.NewInt(2971), big.NewInt(48912491)},
+	},
+	{
+		// 2^64 + 13
+		P:            mustParseBigInt("18446744073709551629"),
+		KnownRoot:    big.NewInt(2),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(7), big.NewInt(658812288346769701)},
+	},
+	{
+		// 2^72 + 15
+		P:            mustParseBigInt("4722366482869645213711"),
+		KnownRoot:    big.NewInt(6),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(5), big.NewInt(4799), big.NewInt(60594931), big.NewInt(541316653)},
+	},
+	{
+		// 2^80 + 13
+		P:            mustParseBigInt("1208925819614629174706189"),
+		KnownRoot:    big.NewInt(2),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(1093), big.NewInt(31039), big.NewInt(8908647580887961)},
+	},
+	{
+		// 2^96 + 61
+		P:            mustParseBigInt("79228162514264337593543950397"),
+		KnownRoot:    big.NewInt(2),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(31), big.NewInt(619), mustParseBigInt("1032208068610458304152691")},
+	},
+	{
+		// 2^112 + 25
+		P:            mustParseBigInt("5192296858534827628530496329220121"),
+		KnownRoot:    big.NewInt(3),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(5), big.NewInt(1201), big.NewInt(28976429), mustParseBigInt("3730024228806121761107")},
+	},
+	{
+		// 2^128 + 51
+		P:            mustParseBigInt("340282366920938463463374607431768211507"),
+		KnownRoot:    big.NewInt(2),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(17), big.NewInt(89), big.NewInt(6481), big.NewInt(5816689), mustParseBigInt("12275703273579557140363")},
+	},
+}
+
+// mustParseBigInt parses a decimal constant that does not fit in an int64.
+func mustParseBigInt(s string) *big.Int {
+	n, ok := big.NewInt(0).SetString(s, 10)
+	if !ok {
+		panic("ziterate: invalid integer constant " + s)
+	}
+	return n
 }
 
 func SmallestZMapGroupFor(n uint64) (*Group, error) {
+	return SmallestZMapGroupForBigInt(big.NewInt(0).SetUint64(n))
+}
+
+// SmallestZMapGroupForBigInt is SmallestZMapGroupFor for target spaces that do
+// not fit in a uint64, such as IPv6 ranges.
+func SmallestZMapGroupForBigInt(n *big.Int) (*Group, error) {
 	for _, g := range ZMapGroups {
-		if g.P.Uint64() > n {
+		if g.P.Cmp(n) > 0 {
 			return g, nil
 		}
 	}
-	return nil, fmt.Errorf("no ZMap group contains %d elements", n)
+	return nil, fmt.Errorf("no ZMap group contains %s elements", n)
 }
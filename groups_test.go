@@ -1,6 +1,10 @@
 package ziterate
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestSmallestZMapGroupFor(t *testing.T) {
 	tests := []struct {
@@ -50,7 +54,66 @@ func TestSmallestZMapGroupFor(t *testing.T) {
 
 func TestSmallestZMapGroupForTooLarge(t *testing.T) {
 	largest := ZMapGroups[len(ZMapGroups)-1]
-	if _, err := SmallestZMapGroupFor(largest.P.Uint64()); err == nil {
+	if _, err := SmallestZMapGroupForBigInt(largest.P); err == nil {
 		t.Fatal("expected error for n equal to largest ZMap prime")
 	}
 }
+
+func TestSmallestZMapGroupForAnyUint64(t *testing.T) {
+	g, err := SmallestZMapGroupFor(math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.P.String(), "18446744073709551629"; got != want {
+		t.Fatalf("got prime %s, want %s", got, want)
+	}
+}
+
+func TestZMapGroupsAreFullyFactored(t *testing.T) {
+	for i, g := range ZMapGroups {
+		if i > 0 && ZMapGroups[i-1].P.Cmp(g.P) >= 0 {
+			t.Fatalf("group %d is not larger than group %d", i, i-1)
+		}
+		rest := big.NewInt(0).Sub(g.P, big.NewInt(1))
+		remainder := big.NewInt(0)
+		for _, f := range g.OrderFactors {
+			if !f.ProbablyPrime(32) {
+				t.Fatalf("group %d: factor %s is not prime", i, f)
+			}
+			for {
+				quotient, r := big.NewInt(0).QuoRem(rest, f, remainder)
+				if r.Sign() != 0 {
+					break
+				}
+				rest = quotient
+			}
+		}
+		if rest.Cmp(big.NewInt(1)) != 0 {
+			t.Fatalf("group %d: factors of P - 1 leave %s unfactored", i, rest)
+		}
+	}
+}
+
+func TestSmallestZMapGroupForBigInt(t *testing.T) {
+	g, err := SmallestZMapGroupForBigInt(big.NewInt(1 << 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.P.Uint64(), uint64(1099511627791); got != want {
+		t.Fatalf("got prime %d, want %d", got, want)
+	}
+	ipv6 := big.NewInt(1)
+	ipv6.Lsh(ipv6, 128)
+	g, err = SmallestZMapGroupForBigInt(ipv6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.P.String(), "340282366920938463463374607431768211507"; got != want {
+		t.Fatalf("got prime %s for 2^128 elements, want %s", got, want)
+	}
+	tooLarge := big.NewInt(1)
+	tooLarge.Lsh(tooLarge, 129)
+	if _, err := SmallestZMapGroupForBigInt(tooLarge); err == nil {
+		t.Fatal("expected error for 2^129 elements")
+	}
+}
@@ -0,0 +1,64 @@
+package ziterate
+
+import "math"
+
+// The set operations below never modify their operands, and return new sets
+// with their own cumulative counts. A nil set is treated as empty. Like
+// NewIPv4RangeSet, they never include 0.0.0.0. Addresses keep their labels,
+// and take the label from s where both operands label them.
+
+// Union returns the addresses in s, other, or both.
+func (s *IPv4RangeSet) Union(other *IPv4RangeSet) *IPv4RangeSet {
+	out := rangeSetFrom(append(s.Ranges(), other.Ranges()...))
+	out.labels = mergeLabels(s.labelList(), other.labelList())
+	return out
+}
+
+// Intersect returns the addresses in both s and other.
+func (s *IPv4RangeSet) Intersect(other *IPv4RangeSet) *IPv4RangeSet {
+	out := rangeSetFrom(intersectRanges(s.Ranges(), other.Ranges()))
+	out.labels = mergeLabels(s.labelList(), other.labelList())
+	return out
+}
+
+// Subtract returns the addresses in s that are not in other.
+func (s *IPv4RangeSet) Subtract(other *IPv4RangeSet) *IPv4RangeSet {
+	out := rangeSetFrom(subtractRanges(s.Ranges(), other.Ranges()))
+	out.labels = s.labelList()
+	return out
+}
+
+// labelList returns the labels of s, which may be nil.
+func (s *IPv4RangeSet) labelList() []ipv4Label {
+	if s == nil {
+		return nil
+	}
+	return s.labels
+}
+
+// Complement returns the addresses that are not in s. Since 0.0.0.0 is never
+// allowed, the union of a set and its complement is the set NewIPv4RangeSet
+// returns when given no allowlist or blocklist.
+func (s *IPv4RangeSet) Complement() *IPv4RangeSet {
+	all := []IPv4Range{{Start: 0, End: math.MaxUint32}}
+	return rangeSetFrom(subtractRanges(all, s.Ranges()))
+}
+
+// intersectRanges returns the overlap of two sorted, non-overlapping lists of
+// ranges.
+func intersectRanges(a, b []IPv4Range) []IPv4Range {
+	var out []IPv4Range
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start := max(a[i].Start, b[j].Start)
+		end := min(a[i].End, b[j].End)
+		if start <= end {
+			out = append(out, IPv4Range{Start: start, End: end})
+		}
+		if a[i].End < b[j].End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
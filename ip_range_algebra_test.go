@@ -0,0 +1,154 @@
+package ziterate
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/quick"
+)
+
+// testRangeSet is a randomly generated IPv4RangeSet, along with the ranges it
+// was built from. Its ranges cluster around the ends of the address space and
+// one address in the middle, so that they often overlap and touch.
+type testRangeSet struct {
+	set    *IPv4RangeSet
+	ranges []IPv4Range
+}
+
+func (testRangeSet) Generate(r *rand.Rand, size int) reflect.Value {
+	bases := []uint64{0, 0x0a000000, math.MaxUint32 - 40}
+	var ranges []IPv4Range
+	for range r.Intn(6) {
+		start := bases[r.Intn(len(bases))] + uint64(r.Intn(32))
+		end := min(start+uint64(r.Intn(16)), math.MaxUint32)
+		ranges = append(ranges, IPv4Range{Start: uint32(start), End: uint32(end)})
+	}
+	return reflect.ValueOf(testRangeSet{
+		set:    rangeSetFrom(slices.Clone(ranges)),
+		ranges: ranges,
+	})
+}
+
+// contains is the reference membership test for the set's ranges.
+func (s testRangeSet) contains(ip uint32) bool {
+	if ip == 0 {
+		return false
+	}
+	for _, r := range s.ranges {
+		if r.Start <= ip && ip <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// probeAddresses returns the addresses at which membership can change in any
+// of the sets.
+func probeAddresses(sets ...testRangeSet) []uint32 {
+	probes := []uint32{0, 1, math.MaxUint32 - 1, math.MaxUint32}
+	for _, s := range sets {
+		for _, r := range s.ranges {
+			probes = append(probes, r.Start-1, r.Start, r.End, r.End+1)
+		}
+	}
+	return probes
+}
+
+// checkWellFormed checks the invariants every IPv4RangeSet maintains.
+func checkWellFormed(t *testing.T, s *IPv4RangeSet) {
+	t.Helper()
+	total := uint64(0)
+	for i, r := range s.ranges {
+		if r.End < r.Start || (i == 0 && r.Start == 0) {
+			t.Fatalf("invalid range %d: %#v", i, r)
+		}
+		if i > 0 && uint64(s.ranges[i-1].End)+1 >= uint64(r.Start) {
+			t.Fatalf("ranges %d and %d overlap or touch: %#v", i-1, i, s.ranges)
+		}
+		total += uint64(r.End) - uint64(r.Start) + 1
+		if r.CumEnd != total {
+			t.Fatalf("range %d has CumEnd %d, want %d", i, r.CumEnd, total)
+		}
+	}
+	if s.Count() != total {
+		t.Fatalf("Count() = %d, want %d", s.Count(), total)
+	}
+}
+
+func TestIPv4RangeSetAlgebra(t *testing.T) {
+	ops := []struct {
+		name string
+		op   func(a, b *IPv4RangeSet) *IPv4RangeSet
+		want func(inA, inB bool) bool
+	}{
+		{"Union", (*IPv4RangeSet).Union, func(inA, inB bool) bool { return inA || inB }},
+		{"Intersect", (*IPv4RangeSet).Intersect, func(inA, inB bool) bool { return inA && inB }},
+		{"Subtract", (*IPv4RangeSet).Subtract, func(inA, inB bool) bool { return inA && !inB }},
+		{"Complement", func(a, _ *IPv4RangeSet) *IPv4RangeSet { return a.Complement() }, func(inA, _ bool) bool { return !inA }},
+	}
+	for _, tt := range ops {
+		t.Run(tt.name, func(t *testing.T) {
+			property := func(a, b testRangeSet) bool {
+				beforeA, beforeB := a.set.Ranges(), b.set.Ranges()
+				got := tt.op(a.set, b.set)
+				checkWellFormed(t, got)
+				if !slices.Equal(a.set.Ranges(), beforeA) || !slices.Equal(b.set.Ranges(), beforeB) {
+					t.Errorf("%s modified its operands", tt.name)
+					return false
+				}
+				for _, ip := range probeAddresses(a, b) {
+					want := ip != 0 && tt.want(a.contains(ip), b.contains(ip))
+					if got.Contains(ip) != want {
+						t.Errorf("%s(%v, %v).Contains(%#x) = %v, want %v", tt.name, a.ranges, b.ranges, ip, !want, want)
+						return false
+					}
+				}
+				return true
+			}
+			if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestIPv4RangeSetAlgebraIdentities(t *testing.T) {
+	full, err := NewIPv4RangeSet(IPv4RangeSetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := func(a, b testRangeSet) bool {
+		complement := a.set.Complement()
+		return slices.Equal(a.set.Union(complement).Ranges(), full.Ranges()) &&
+			a.set.Intersect(complement).Count() == 0 &&
+			slices.Equal(complement.Complement().Ranges(), a.set.Ranges()) &&
+			slices.Equal(a.set.Subtract(b.set).Ranges(), a.set.Intersect(b.set.Complement()).Ranges()) &&
+			slices.Equal(a.set.Union(b.set).Ranges(), b.set.Union(a.set).Ranges()) &&
+			slices.Equal(a.set.Intersect(b.set).Ranges(), b.set.Intersect(a.set).Ranges())
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIPv4RangeSetAlgebraNil(t *testing.T) {
+	var empty *IPv4RangeSet
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := empty.Union(set); !slices.Equal(got.Ranges(), set.Ranges()) {
+		t.Fatalf("nil.Union(set) = %v, want %v", got.Ranges(), set.Ranges())
+	}
+	if got := set.Intersect(empty); got.Count() != 0 {
+		t.Fatalf("set.Intersect(nil) has %d addresses, want 0", got.Count())
+	}
+	if got := set.Subtract(nil); !slices.Equal(got.Ranges(), set.Ranges()) {
+		t.Fatalf("set.Subtract(nil) = %v, want %v", got.Ranges(), set.Ranges())
+	}
+	if got, want := empty.Complement().Count(), uint64(math.MaxUint32); got != want {
+		t.Fatalf("nil.Complement() has %d addresses, want %d", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+package ziterate
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// ipv4Label is a stretch of addresses that share a label.
+type ipv4Label struct {
+	Start uint32
+	End   uint32
+	Label string
+}
+
+// labelsFrom returns the labels of ranges as sorted, non-overlapping stretches.
+// Where labeled ranges overlap, an address takes the label of the range that
+// starts first, or that comes first if they start at the same address.
+func labelsFrom(ranges []IPv4Range) []ipv4Label {
+	var labeled []IPv4Range
+	for _, r := range ranges {
+		if r.label != "" && r.Start <= r.End {
+			labeled = append(labeled, r)
+		}
+	}
+	slices.SortStableFunc(labeled, func(a, b IPv4Range) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	var out []ipv4Label
+	for _, r := range labeled {
+		start := r.Start
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if r.End <= last.End {
+				continue
+			}
+			start = max(start, last.End+1)
+		}
+		if len(out) > 0 && out[len(out)-1].Label == r.label && out[len(out)-1].End+1 == start {
+			out[len(out)-1].End = r.End
+			continue
+		}
+		out = append(out, ipv4Label{Start: start, End: r.End, Label: r.label})
+	}
+	return out
+}
+
+// ipv4Entry is a stretch of allowed addresses from one allowlist line.
+type ipv4Entry struct {
+	Start uint32
+	End   uint32
+	Line  int
+}
+
+// entriesFrom returns the addresses of allowed, which must be sorted and
+// non-overlapping, as sorted, non-overlapping stretches labeled with the
+// allowlist line of the range in ranges they came from. As with labels, where
+// ranges overlap, an address belongs to the range that starts first, or to the
+// earlier line if they start at the same address.
+func entriesFrom(ranges, allowed []IPv4Range) []ipv4Entry {
+	ranges = slices.Clone(ranges)
+	slices.SortFunc(ranges, func(a, b IPv4Range) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(a.line, b.line))
+	})
+	var lines []ipv4Entry
+	for _, r := range ranges {
+		if r.Start > r.End {
+			continue
+		}
+		start := r.Start
+		if len(lines) > 0 {
+			last := lines[len(lines)-1]
+			if r.End <= last.End {
+				continue
+			}
+			start = max(start, last.End+1)
+		}
+		lines = append(lines, ipv4Entry{Start: start, End: r.End, Line: r.line})
+	}
+	var out []ipv4Entry
+	j := 0
+	for _, e := range lines {
+		for j < len(allowed) && allowed[j].End < e.Start {
+			j++
+		}
+		for k := j; k < len(allowed) && allowed[k].Start <= e.End; k++ {
+			out = append(out, ipv4Entry{Start: max(e.Start, allowed[k].Start), End: min(e.End, allowed[k].End), Line: e.Line})
+		}
+	}
+	return out
+}
+
+// mergeLabels returns the labels of a, and those of b for addresses that have
+// no label in a.
+func mergeLabels(a, b []ipv4Label) []ipv4Label {
+	if len(b) == 0 {
+		return a
+	}
+	var unlabeled []IPv4Range
+	for _, l := range a {
+		unlabeled = append(unlabeled, IPv4Range{Start: l.Start, End: l.End})
+	}
+	var out []ipv4Label
+	out = append(out, a...)
+	for _, l := range b {
+		for _, r := range subtractRanges([]IPv4Range{{Start: l.Start, End: l.End}}, unlabeled) {
+			out = append(out, ipv4Label{Start: r.Start, End: r.End, Label: l.Label})
+		}
+	}
+	slices.SortFunc(out, func(x, y ipv4Label) int {
+		return cmp.Compare(x.Start, y.Start)
+	})
+	return out
+}
+
+// Label returns the label of ip: the text after the address on the allowlist
+// line it came from, or the line's comment if there is no such text. It
+// returns the empty string for unlabeled and disallowed addresses.
+func (s *IPv4RangeSet) Label(ip uint32) string {
+	if s == nil || len(s.labels) == 0 || !s.Contains(ip) {
+		return ""
+	}
+	i := sort.Search(len(s.labels), func(i int) bool {
+		return s.labels[i].End >= ip
+	})
+	if i == len(s.labels) || s.labels[i].Start > ip {
+		return ""
+	}
+	return s.labels[i].Label
+}
+
+// LookupLabel is like Lookup, but also returns the address's label.
+func (s *IPv4RangeSet) LookupLabel(index uint64) (uint32, string, bool) {
+	ip, ok := s.Lookup(index)
+	if !ok {
+		return 0, "", false
+	}
+	return ip, s.Label(ip), true
+}
+
+// HasLabels reports whether any allowed address has a label.
+func (s *IPv4RangeSet) HasLabels() bool {
+	return s != nil && len(s.labels) > 0
+}
@@ -0,0 +1,120 @@
+package ziterate
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPv4RangeSetLabels(t *testing.T) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{
+			"10.0.0.0/24 customer-a experiment 1\n" +
+				"10.0.0.128/25 customer-b\n" +
+				"10.0.1.0 255.255.255.0 # customer-c\n" +
+				"10.0.2.1 - 10.0.2.9 customer-d # not the label\n" +
+				"10.0.3.0/24\n" +
+				"10.0.0.64/26 customer-e",
+		},
+		BlockEntries: []string{"10.0.0.1 blocked"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.HasLabels() {
+		t.Fatal("HasLabels() = false, want true")
+	}
+	tests := []struct {
+		addr  string
+		label string
+	}{
+		{"10.0.0.0", "customer-a experiment 1"},
+		{"10.0.0.1", ""},
+		{"10.0.0.64", "customer-a experiment 1"},
+		{"10.0.0.200", "customer-a experiment 1"},
+		{"10.0.1.77", "customer-c"},
+		{"10.0.2.1", "customer-d"},
+		{"10.0.2.9", "customer-d"},
+		{"10.0.2.10", ""},
+		{"10.0.3.1", ""},
+	}
+	for _, tt := range tests {
+		ip := ipv4AddrToUint32(netip.MustParseAddr(tt.addr))
+		if got := set.Label(ip); got != tt.label {
+			t.Fatalf("Label(%s) = %q, want %q", tt.addr, got, tt.label)
+		}
+	}
+
+	ip, label, ok := set.LookupLabel(0)
+	if !ok || ip != 0x0a000000 || label != "customer-a experiment 1" {
+		t.Fatalf("LookupLabel(0) = %#x, %q, %v", ip, label, ok)
+	}
+	if _, _, ok := set.LookupLabel(set.Count()); ok {
+		t.Fatal("LookupLabel(Count()) returned true")
+	}
+
+	unlabeled, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlabeled.HasLabels() {
+		t.Fatal("HasLabels() = true for a set without labels")
+	}
+}
+
+func TestIPv4RangeSetLabelsSetOperations(t *testing.T) {
+	a, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/25 a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/24 b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	union := a.Union(b)
+	if got := union.Label(0x0a000001); got != "a" {
+		t.Fatalf("union label of 10.0.0.1 = %q, want a", got)
+	}
+	if got := union.Label(0x0a0000ff); got != "b" {
+		t.Fatalf("union label of 10.0.0.255 = %q, want b", got)
+	}
+	if got := b.Intersect(a).Label(0x0a000001); got != "b" {
+		t.Fatalf("intersection label of 10.0.0.1 = %q, want b", got)
+	}
+	if got := b.Subtract(a).Label(0x0a0000ff); got != "b" {
+		t.Fatalf("difference label of 10.0.0.255 = %q, want b", got)
+	}
+}
+
+func TestTargetIteratorLabels(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/30 first\n10.0.1.0/30 second\n10.0.2.0/30"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(23)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for record, ok := it.NextRecord(); ok; record, ok = it.NextRecord() {
+		count++
+		want := map[uint32]string{0x0a000000: "first", 0x0a000100: "second", 0x0a000200: ""}[record.IP&^3]
+		if record.Label != want {
+			t.Fatalf("%s has label %q, want %q", Uint32ToIPv4(record.IP), record.Label, want)
+		}
+	}
+	if count != 12 {
+		t.Fatalf("got %d targets, want 12", count)
+	}
+}
+
+func TestIPv4PresetLabels(t *testing.T) {
+	preset, err := IPv4Preset("documentation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := preset.Label(0xc6336401), "Documentation (TEST-NET-2), RFC 5737"; got != want {
+		t.Fatalf("Label(198.51.100.1) = %q, want %q", got, want)
+	}
+}
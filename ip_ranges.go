@@ -2,12 +2,16 @@ package ziterate
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"math"
+	"math/bits"
 	"net/netip"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,12 +20,22 @@ type IPv4Range struct {
 	Start  uint32
 	End    uint32
 	CumEnd uint64
+
+	// label is the label of the allowlist line the range was parsed from,
+	// and line is the line's position among the allowlist lines.
+	label string
+	line  int
 }
 
 // IPv4RangeSet stores sorted, non-overlapping allowed IPv4 ranges.
 type IPv4RangeSet struct {
 	ranges []IPv4Range
 	total  uint64
+	labels []ipv4Label
+	// entries holds the allowed addresses of each allowlist line, and lines
+	// is the number of lines, for sets parsed from an allowlist.
+	entries []ipv4Entry
+	lines   int
 }
 
 // IPv4RangeSetOptions configures construction of an IPv4RangeSet.
@@ -30,6 +44,20 @@ type IPv4RangeSetOptions struct {
 	AllowFiles   []string
 	BlockEntries []string
 	BlockFiles   []string
+
+	// ExcludePresets names built-in blocklists, from IPv4PresetNames, that
+	// are subtracted along with BlockEntries and BlockFiles.
+	ExcludePresets []string
+
+	// Resolver, if set, resolves hostnames in allowlists and blocklists to
+	// their IPv4 addresses. Otherwise hostnames are rejected.
+	Resolver Resolver
+
+	// Lenient skips invalid lines in allowlists and blocklists, and passes
+	// each one to OnInvalidLine if it is set. Otherwise every invalid line is
+	// reported in a RangeParseErrors.
+	Lenient       bool
+	OnInvalidLine func(*RangeParseError)
 }
 
 // NewIPv4RangeSet constructs an IPv4RangeSet from allowlist and blocklist
@@ -42,27 +70,66 @@ func NewIPv4RangeSet(opts IPv4RangeSetOptions) (*IPv4RangeSet, error) {
 		allowed = []IPv4Range{{Start: 0, End: math.MaxUint32}}
 	}
 
-	allowRanges, err := parseRangeSources(opts.AllowEntries, opts.AllowFiles)
+	parse := ipv4LineParser(opts.Resolver)
+	errs := &rangeParseErrors{lenient: opts.Lenient, onInvalid: opts.OnInvalidLine}
+	// Number the allowlist lines, counting invalid ones, so that each range
+	// records the line it came from.
+	lines := 0
+	numbered := func(fields []string, comment string) ([]IPv4Range, error) {
+		ranges, err := parse(fields, comment)
+		for i := range ranges {
+			ranges[i].line = lines
+		}
+		lines++
+		return ranges, err
+	}
+	allowRanges, err := parseRangeSources(opts.AllowEntries, opts.AllowFiles, numbered, errs)
 	if err != nil {
 		return nil, err
 	}
+	var labels []ipv4Label
+	var lineRanges []IPv4Range
 	if hasAllowlist {
+		labels = labelsFrom(allowRanges)
+		lineRanges = slices.Clone(allowRanges)
 		allowed = normalizeRanges(allowRanges)
 	}
 
-	blockRanges, err := parseRangeSources(opts.BlockEntries, opts.BlockFiles)
+	blockRanges, err := parseRangeSources(opts.BlockEntries, opts.BlockFiles, parse, errs)
 	if err != nil {
 		return nil, err
 	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	for _, name := range opts.ExcludePresets {
+		ranges, err := presetRanges(name)
+		if err != nil {
+			return nil, err
+		}
+		blockRanges = append(blockRanges, ranges...)
+	}
 	allowed = subtractRanges(allowed, normalizeRanges(blockRanges))
-	allowed = subtractRanges(allowed, []IPv4Range{{Start: 0, End: 0}})
+	set := rangeSetFrom(allowed)
+	set.labels = labels
+	if hasAllowlist {
+		set.entries = entriesFrom(lineRanges, set.ranges)
+		set.lines = lines
+	}
+	return set, nil
+}
+
+// rangeSetFrom returns the set of addresses in ranges, other than 0.0.0.0,
+// which is never allowed. ranges may be reordered.
+func rangeSetFrom(ranges []IPv4Range) *IPv4RangeSet {
+	allowed := subtractRanges(normalizeRanges(ranges), []IPv4Range{{Start: 0, End: 0}})
 	allowed = withCumulativeCounts(normalizeRanges(allowed))
 
 	total := uint64(0)
 	if len(allowed) > 0 {
 		total = allowed[len(allowed)-1].CumEnd
 	}
-	return &IPv4RangeSet{ranges: allowed, total: total}, nil
+	return &IPv4RangeSet{ranges: allowed, total: total}
 }
 
 // Count returns the number of allowed IPv4 addresses.
@@ -91,6 +158,79 @@ func (s *IPv4RangeSet) Lookup(index uint64) (uint32, bool) {
 	return s.ranges[i].Start + uint32(index-prevCum), true
 }
 
+// IndexOf returns the index of ip among the allowed addresses, the inverse of
+// Lookup, and false if ip is not allowed.
+func (s *IPv4RangeSet) IndexOf(ip uint32) (uint64, bool) {
+	i, ok := s.rangeOf(ip)
+	if !ok {
+		return 0, false
+	}
+	prevCum := uint64(0)
+	if i > 0 {
+		prevCum = s.ranges[i-1].CumEnd
+	}
+	return prevCum + uint64(ip-s.ranges[i].Start), true
+}
+
+// Contains reports whether ip is allowed.
+func (s *IPv4RangeSet) Contains(ip uint32) bool {
+	_, ok := s.rangeOf(ip)
+	return ok
+}
+
+// IndexOfAddr is IndexOf for a netip.Addr. It returns false for addresses that
+// are not IPv4.
+func (s *IPv4RangeSet) IndexOfAddr(addr netip.Addr) (uint64, bool) {
+	if !addr.Is4() {
+		return 0, false
+	}
+	return s.IndexOf(ipv4AddrToUint32(addr))
+}
+
+// ContainsAddr is Contains for a netip.Addr. It returns false for addresses
+// that are not IPv4.
+func (s *IPv4RangeSet) ContainsAddr(addr netip.Addr) bool {
+	_, ok := s.IndexOfAddr(addr)
+	return ok
+}
+
+// IndexOfPrefix returns the index of the first address of prefix, and false
+// unless every address in prefix is allowed. The addresses in the prefix have
+// consecutive indexes.
+func (s *IPv4RangeSet) IndexOfPrefix(prefix netip.Prefix) (uint64, bool) {
+	if !prefix.IsValid() || !prefix.Addr().Is4() {
+		return 0, false
+	}
+	prefix = prefix.Masked()
+	start := ipv4AddrToUint32(prefix.Addr())
+	end := uint32(uint64(start) + uint64(1)<<uint(32-prefix.Bits()) - 1)
+	i, ok := s.rangeOf(start)
+	if !ok || s.ranges[i].End < end {
+		return 0, false
+	}
+	return s.IndexOf(start)
+}
+
+// ContainsPrefix reports whether every address in prefix is allowed.
+func (s *IPv4RangeSet) ContainsPrefix(prefix netip.Prefix) bool {
+	_, ok := s.IndexOfPrefix(prefix)
+	return ok
+}
+
+// rangeOf returns the position of the range that contains ip.
+func (s *IPv4RangeSet) rangeOf(ip uint32) (int, bool) {
+	if s == nil {
+		return 0, false
+	}
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].End >= ip
+	})
+	if i == len(s.ranges) || s.ranges[i].Start > ip {
+		return 0, false
+	}
+	return i, true
+}
+
 // Ranges returns a copy of the allowed IPv4 ranges.
 func (s *IPv4RangeSet) Ranges() []IPv4Range {
 	if s == nil {
@@ -101,6 +241,32 @@ func (s *IPv4RangeSet) Ranges() []IPv4Range {
 	return out
 }
 
+// Prefixes returns the smallest list of CIDR prefixes that covers exactly the
+// allowed addresses, in ascending order.
+func (s *IPv4RangeSet) Prefixes() []netip.Prefix {
+	if s == nil {
+		return nil
+	}
+	var out []netip.Prefix
+	for _, r := range s.ranges {
+		start, end := uint64(r.Start), uint64(r.End)
+		for start <= end {
+			// The largest block that starts at start is limited by the
+			// alignment of start, and by the end of the range.
+			size := uint64(1) << 32
+			if start != 0 {
+				size = start & -start
+			}
+			for start+size-1 > end {
+				size >>= 1
+			}
+			out = append(out, netip.PrefixFrom(Uint32ToIPv4(uint32(start)), 32-bits.TrailingZeros64(size)))
+			start += size
+		}
+	}
+	return out
+}
+
 // Uint32ToIPv4 converts a host-order uint32 IPv4 address to netip.Addr.
 func Uint32ToIPv4(ip uint32) netip.Addr {
 	return netip.AddrFrom4([4]byte{
@@ -111,10 +277,29 @@ func Uint32ToIPv4(ip uint32) netip.Addr {
 	})
 }
 
-func parseRangeSources(entries, files []string) ([]IPv4Range, error) {
-	var out []IPv4Range
+// rangeLineParser parses the whitespace separated fields of one allowlist or
+// blocklist line into ranges. comment is the text after any "#", which is not
+// part of fields.
+type rangeLineParser[R any] func(fields []string, comment string) ([]R, error)
+
+// firstField returns a rangeLineParser that parses the first field of each
+// line with parse, and ignores the rest.
+func firstField[R any](parse func(string) (R, error)) rangeLineParser[R] {
+	return func(fields []string, comment string) ([]R, error) {
+		r, err := parse(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		return []R{r}, nil
+	}
+}
+
+// parseRangeSources parses every entry and file. Invalid lines are recorded in
+// errs, and only errors reading files are returned.
+func parseRangeSources[R any](entries, files []string, parse rangeLineParser[R], errs *rangeParseErrors) ([]R, error) {
+	var out []R
 	for _, entry := range entries {
-		ranges, err := parseRangeLines(strings.NewReader(entry))
+		ranges, err := parseRangeLines(strings.NewReader(entry), "", parse, errs)
 		if err != nil {
 			return nil, err
 		}
@@ -125,10 +310,10 @@ func parseRangeSources(entries, files []string) ([]IPv4Range, error) {
 		if err != nil {
 			return nil, err
 		}
-		ranges, readErr := parseRangeLines(file)
+		ranges, readErr := parseRangeLines(file, path, parse, errs)
 		closeErr := file.Close()
 		if readErr != nil {
-			return nil, fmt.Errorf("%s: %w", path, readErr)
+			return nil, readErr
 		}
 		if closeErr != nil {
 			return nil, closeErr
@@ -138,26 +323,171 @@ func parseRangeSources(entries, files []string) ([]IPv4Range, error) {
 	return out, nil
 }
 
-func parseRangeLines(r io.Reader) ([]IPv4Range, error) {
-	var out []IPv4Range
+// parseRangeLines parses every line read from r, the file with the given name,
+// or an entry if name is empty. Invalid lines are recorded in errs.
+func parseRangeLines[R any](r io.Reader, name string, parse rangeLineParser[R], errs *rangeParseErrors) ([]R, error) {
+	var out []R
 	scanner := bufio.NewScanner(r)
+	line := 0
 	for scanner.Scan() {
-		entry := strings.Split(scanner.Text(), "#")[0]
+		line++
+		text := scanner.Text()
+		entry, comment, _ := strings.Cut(text, "#")
 		fields := strings.Fields(entry)
 		if len(fields) == 0 {
 			continue
 		}
-		ipRange, err := parseIPv4Range(fields[0])
+		ranges, err := parse(fields, comment)
+		if err != nil {
+			errs.add(&RangeParseError{
+				File:   name,
+				Line:   line,
+				Column: strings.Index(entry, fields[0]) + 1,
+				Text:   text,
+				Err:    err,
+			})
+			continue
+		}
+		out = append(out, ranges...)
+	}
+	if err := scanner.Err(); err != nil {
+		if name != "" {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Resolver looks up the addresses of hostnames in allowlists and blocklists.
+// *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// ipv4LineParser returns the rangeLineParser for IPv4 allowlists and
+// blocklists. Each line holds one of:
+//
+//   - an address, such as 192.0.2.1;
+//   - a prefix, such as 192.0.2.0/24 or 192.0.2.0/255.255.255.0;
+//   - an address and a dotted netmask, such as 192.0.2.0 255.255.255.0;
+//   - an inclusive range, such as 192.0.2.5-192.0.2.250 or
+//     192.0.2.5 - 192.0.2.250;
+//   - a hostname, if resolver is not nil, which stands for every IPv4
+//     address it resolves to.
+//
+// The rest of the line, or the comment if there is nothing else, is the
+// label of the ranges.
+func ipv4LineParser(resolver Resolver) rangeLineParser[IPv4Range] {
+	return func(fields []string, comment string) ([]IPv4Range, error) {
+		entry, rest := fields[0], fields[1:]
+		switch {
+		case len(fields) >= 3 && fields[1] == "-":
+			entry, rest = fields[0]+"-"+fields[2], fields[3:]
+		case len(fields) >= 2 && isIPv4Netmask(fields[1]):
+			entry, rest = fields[0]+"/"+fields[1], fields[2:]
+		}
+		label := strings.Join(rest, " ")
+		if label == "" {
+			label = strings.TrimSpace(comment)
+		}
+		ranges, err := resolveIPv4Range(entry, resolver)
 		if err != nil {
 			return nil, err
 		}
-		out = append(out, ipRange)
+		for i := range ranges {
+			ranges[i].label = label
+		}
+		return ranges, nil
+	}
+}
+
+// resolveIPv4Range parses entry with parseIPv4Range, or resolves it if it is
+// a hostname and resolver is not nil.
+func resolveIPv4Range(entry string, resolver Resolver) ([]IPv4Range, error) {
+	r, err := parseIPv4Range(entry)
+	if err == nil {
+		return []IPv4Range{r}, nil
+	}
+	if resolver == nil || !isHostname(entry) {
+		return nil, err
+	}
+	addrs, err := resolver.LookupNetIP(context.Background(), "ip4", entry)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", entry, err)
+	}
+	var out []IPv4Range
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.Is4() {
+			ip := ipv4AddrToUint32(addr)
+			out = append(out, IPv4Range{Start: ip, End: ip})
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s has no IPv4 addresses", entry)
+	}
+	return out, nil
+}
+
+// isIPv4Netmask reports whether s is a dotted netmask such as 255.255.255.0.
+func isIPv4Netmask(s string) bool {
+	_, ok := parseIPv4Netmask(s)
+	return ok
+}
+
+// parseIPv4Netmask returns the prefix length of the dotted netmask s.
+func parseIPv4Netmask(s string) (int, bool) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return 0, false
+	}
+	mask := ipv4AddrToUint32(addr)
+	ones := bits.LeadingZeros32(^mask)
+	if mask != ^uint32(0)<<(32-ones) {
+		return 0, false
+	}
+	return ones, true
+}
+
+// isHostname reports whether s looks like a DNS name rather than a malformed
+// address: it has a letter, and only letters, digits, hyphens, dots and
+// underscores.
+func isHostname(s string) bool {
+	letter := false
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			letter = true
+		case '0' <= c && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return false
+		}
 	}
-	return out, scanner.Err()
+	return letter
 }
 
+// parseIPv4Range parses an address, a prefix with a length or a dotted
+// netmask, or an inclusive range of two addresses separated by a dash.
 func parseIPv4Range(entry string) (IPv4Range, error) {
-	if strings.Contains(entry, "/") {
+	if first, last, ok := strings.Cut(entry, "-"); ok {
+		start, err := parseIPv4Addr(first)
+		if err != nil {
+			return IPv4Range{}, err
+		}
+		end, err := parseIPv4Addr(last)
+		if err != nil {
+			return IPv4Range{}, err
+		}
+		if end < start {
+			return IPv4Range{}, fmt.Errorf("range %s ends before it starts", entry)
+		}
+		return IPv4Range{Start: start, End: end}, nil
+	}
+	if addrDef, maskDef, ok := strings.Cut(entry, "/"); ok {
+		if ones, ok := parseIPv4Netmask(maskDef); ok {
+			entry = addrDef + "/" + strconv.Itoa(ones)
+		}
 		prefix, err := netip.ParsePrefix(entry)
 		if err != nil {
 			return IPv4Range{}, err
@@ -174,15 +504,23 @@ func parseIPv4Range(entry string) (IPv4Range, error) {
 			End:   uint32(uint64(start) + size - 1),
 		}, nil
 	}
-	addr, err := netip.ParseAddr(entry)
+	ip, err := parseIPv4Addr(entry)
 	if err != nil {
 		return IPv4Range{}, err
 	}
+	return IPv4Range{Start: ip, End: ip}, nil
+}
+
+// parseIPv4Addr parses an IPv4 address into host byte order.
+func parseIPv4Addr(s string) (uint32, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return 0, err
+	}
 	if !addr.Is4() {
-		return IPv4Range{}, fmt.Errorf("not an IPv4 address: %s", entry)
+		return 0, fmt.Errorf("not an IPv4 address: %s", s)
 	}
-	ip := ipv4AddrToUint32(addr)
-	return IPv4Range{Start: ip, End: ip}, nil
+	return ipv4AddrToUint32(addr), nil
 }
 
 func ipv4AddrToUint32(addr netip.Addr) uint32 {
@@ -1,9 +1,16 @@
 package ziterate
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"testing/quick"
 )
 
 func TestIPv4RangeSetParsingLookupAndZeroExclusion(t *testing.T) {
@@ -106,3 +113,212 @@ func TestIPv4RangeSetFiles(t *testing.T) {
 		t.Fatalf("Count() = %d, want %d", got, want)
 	}
 }
+
+func TestIPv4RangeSetIndexOfAndContains(t *testing.T) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/30", "10.0.1.0/31", "192.168.0.1/32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < set.Count(); i++ {
+		ip, _ := set.Lookup(i)
+		got, ok := set.IndexOf(ip)
+		if !ok || got != i {
+			t.Fatalf("IndexOf(%s) = %d, %v, want %d", Uint32ToIPv4(ip), got, ok, i)
+		}
+		if got, ok := set.IndexOfAddr(Uint32ToIPv4(ip)); !ok || got != i {
+			t.Fatalf("IndexOfAddr(%s) = %d, %v, want %d", Uint32ToIPv4(ip), got, ok, i)
+		}
+		if !set.Contains(ip) || !set.ContainsAddr(Uint32ToIPv4(ip)) {
+			t.Fatalf("%s is not contained", Uint32ToIPv4(ip))
+		}
+	}
+	for _, ip := range []uint32{0, 0x0a000004, 0x0a000102, 0xc0a80000, 0xc0a80002, 0xffffffff} {
+		if _, ok := set.IndexOf(ip); ok {
+			t.Fatalf("IndexOf(%s) returned true", Uint32ToIPv4(ip))
+		}
+		if set.Contains(ip) {
+			t.Fatalf("Contains(%s) returned true", Uint32ToIPv4(ip))
+		}
+	}
+	if set.ContainsAddr(netip.MustParseAddr("::ffff:10.0.0.1")) {
+		t.Fatal("ContainsAddr() returned true for an IPv6 address")
+	}
+	var empty *IPv4RangeSet
+	if empty.Contains(0x0a000001) {
+		t.Fatal("Contains() on a nil set returned true")
+	}
+
+	tests := []struct {
+		prefix string
+		index  uint64
+		ok     bool
+	}{
+		{"10.0.0.0/30", 0, true},
+		{"10.0.0.2/31", 2, true},
+		{"10.0.0.3/32", 3, true},
+		{"10.0.1.1/31", 4, true},
+		{"192.168.0.1/32", 6, true},
+		{"10.0.0.0/29", 0, false},
+		{"10.0.0.0/23", 0, false},
+		{"192.168.0.0/31", 0, false},
+		{"2001:db8::/32", 0, false},
+	}
+	for _, tt := range tests {
+		prefix := netip.MustParsePrefix(tt.prefix)
+		index, ok := set.IndexOfPrefix(prefix)
+		if ok != tt.ok || (ok && index != tt.index) {
+			t.Fatalf("IndexOfPrefix(%s) = %d, %v, want %d, %v", tt.prefix, index, ok, tt.index, tt.ok)
+		}
+		if set.ContainsPrefix(prefix) != tt.ok {
+			t.Fatalf("ContainsPrefix(%s) = %v, want %v", tt.prefix, !tt.ok, tt.ok)
+		}
+	}
+}
+
+func TestIPv4RangeSetPrefixes(t *testing.T) {
+	tests := []struct {
+		allow []string
+		block []string
+		want  []string
+	}{
+		{allow: []string{"10.0.0.0/24"}, want: []string{"10.0.0.0/24"}},
+		{allow: []string{"10.0.0.0/25", "10.0.0.128/25"}, want: []string{"10.0.0.0/24"}},
+		{allow: []string{"10.0.0.1", "10.0.0.2/31", "10.0.0.4/30"}, want: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30"}},
+		{allow: []string{"10.0.0.0/24"}, block: []string{"10.0.0.64/26"}, want: []string{"10.0.0.0/26", "10.0.0.128/25"}},
+		{allow: []string{"255.255.255.254/31"}, want: []string{"255.255.255.254/31"}},
+		{want: []string{
+			"0.0.0.1/32", "0.0.0.2/31", "0.0.0.4/30", "0.0.0.8/29", "0.0.0.16/28", "0.0.0.32/27",
+			"0.0.0.64/26", "0.0.0.128/25", "0.0.1.0/24", "0.0.2.0/23", "0.0.4.0/22", "0.0.8.0/21",
+			"0.0.16.0/20", "0.0.32.0/19", "0.0.64.0/18", "0.0.128.0/17", "0.1.0.0/16", "0.2.0.0/15",
+			"0.4.0.0/14", "0.8.0.0/13", "0.16.0.0/12", "0.32.0.0/11", "0.64.0.0/10", "0.128.0.0/9",
+			"1.0.0.0/8", "2.0.0.0/7", "4.0.0.0/6", "8.0.0.0/5", "16.0.0.0/4", "32.0.0.0/3",
+			"64.0.0.0/2", "128.0.0.0/1",
+		}},
+	}
+	for _, tt := range tests {
+		set, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: tt.allow, BlockEntries: tt.block})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, prefix := range set.Prefixes() {
+			got = append(got, prefix.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("Prefixes() of %v minus %v = %v, want %v", tt.allow, tt.block, got, tt.want)
+		}
+	}
+}
+
+func TestIPv4RangeSetPrefixesCoverSet(t *testing.T) {
+	property := func(a testRangeSet) bool {
+		var ranges []IPv4Range
+		for _, prefix := range a.set.Prefixes() {
+			if prefix != prefix.Masked() {
+				return false
+			}
+			parsed, err := parseIPv4Range(prefix.String())
+			if err != nil {
+				return false
+			}
+			ranges = append(ranges, parsed)
+		}
+		return slices.Equal(rangeSetFrom(ranges).Ranges(), a.set.Ranges())
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIPv4RangeSetRangeSyntax(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  []IPv4Range
+	}{
+		{"10.0.0.5-10.0.0.250", []IPv4Range{{Start: 0x0a000005, End: 0x0a0000fa}}},
+		{"10.0.0.5 - 10.0.0.250 # spaced", []IPv4Range{{Start: 0x0a000005, End: 0x0a0000fa}}},
+		{"10.0.0.7-10.0.0.7", []IPv4Range{{Start: 0x0a000007, End: 0x0a000007}}},
+		{"10.0.0.0 255.255.255.0", []IPv4Range{{Start: 0x0a000000, End: 0x0a0000ff}}},
+		{"10.0.0.9 255.255.255.248", []IPv4Range{{Start: 0x0a000008, End: 0x0a00000f}}},
+		{"10.0.0.0/255.255.0.0", []IPv4Range{{Start: 0x0a000000, End: 0x0a00ffff}}},
+		{"10.0.0.1 255.0.255.0", []IPv4Range{{Start: 0x0a000001, End: 0x0a000001}}},
+		{"10.0.0.1 255.255.255.255", []IPv4Range{{Start: 0x0a000001, End: 0x0a000001}}},
+	}
+	for _, tt := range tests {
+		set, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{tt.entry}})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.entry, err)
+		}
+		got := set.Ranges()
+		for i := range got {
+			got[i].CumEnd = 0
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%q: ranges = %#v, want %#v", tt.entry, got, tt.want)
+		}
+	}
+
+	for _, entry := range []string{"10.0.0.9-10.0.0.1", "10.0.0.1-", "10.0.0.0/255.0.255.0", "2001:db8::1-2001:db8::2", "example.com"} {
+		if _, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{entry}}); err == nil {
+			t.Fatalf("%q: expected error", entry)
+		}
+	}
+}
+
+// stubResolver resolves hostnames from a map.
+type stubResolver map[string][]netip.Addr
+
+func (r stubResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if network != "ip4" {
+		return nil, fmt.Errorf("unexpected network %s", network)
+	}
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestIPv4RangeSetResolver(t *testing.T) {
+	resolver := stubResolver{
+		"scan-target.example": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("::ffff:192.0.2.9")},
+		"blocked.example":     {netip.MustParseAddr("192.0.2.9")},
+		"v6only.example":      {netip.MustParseAddr("2001:db8::1")},
+	}
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"scan-target.example\n198.51.100.0/30"},
+		BlockEntries: []string{"blocked.example"},
+		Resolver:     resolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.1/32", "198.51.100.0/30"}
+	var got []string
+	for _, prefix := range set.Prefixes() {
+		got = append(got, prefix.String())
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Prefixes() = %v, want %v", got, want)
+	}
+
+	for _, entry := range []string{"missing.example", "v6only.example"} {
+		_, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{entry}, Resolver: resolver})
+		if err == nil || !strings.Contains(err.Error(), entry) {
+			t.Fatalf("%s: error = %v, want an error naming the host", entry, err)
+		}
+	}
+}
+
+func TestIPv4RangeSetFileErrorsHaveLineNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(path, []byte("# header\n10.0.0.0/24\n\n10.0.0.300\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowFiles: []string{path}})
+	if err == nil || !strings.HasPrefix(err.Error(), path+":4:1: ") {
+		t.Fatalf("error = %v, want it to start with %s:4:1:", err, path)
+	}
+}
@@ -0,0 +1,84 @@
+package ziterate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IPv4Index maps target indexes to allowed IPv4 addresses in host byte order.
+// IPv4RangeSet implements it with a binary search over its ranges.
+type IPv4Index interface {
+	Count() uint64
+	Lookup(index uint64) (uint32, bool)
+}
+
+// pagedIndexBits is the log2 of the number of indexes in each page. It matches
+// the 4096-address radix blocks in ZMap's constraint.c.
+const pagedIndexBits = 12
+
+// PagedIPv4Index is an IPv4Index that returns the same addresses as its
+// IPv4RangeSet, in near-constant time. Like the radix table in ZMap's
+// constraint.c, it splits the index space into pages of 4096 indexes, and
+// records the first range each page falls in. A lookup only searches the
+// ranges that start inside the page, so its cost no longer grows with the
+// total number of ranges.
+type PagedIPv4Index struct {
+	ranges []IPv4Range
+	pages  []uint32
+	total  uint64
+}
+
+// NewPagedIPv4Index builds a PagedIPv4Index over the addresses in set. It uses
+// four bytes for every 4096 allowed addresses.
+func NewPagedIPv4Index(set *IPv4RangeSet) (*PagedIPv4Index, error) {
+	if set == nil {
+		return &PagedIPv4Index{}, nil
+	}
+	if uint64(len(set.ranges)) > 1<<32 {
+		return nil, fmt.Errorf("too many ranges to index: %d", len(set.ranges))
+	}
+	pageCount := (set.total + 1<<pagedIndexBits - 1) >> pagedIndexBits
+	out := &PagedIPv4Index{
+		ranges: set.ranges,
+		pages:  make([]uint32, pageCount),
+		total:  set.total,
+	}
+	r := 0
+	for page := range out.pages {
+		first := uint64(page) << pagedIndexBits
+		for out.ranges[r].CumEnd <= first {
+			r++
+		}
+		out.pages[page] = uint32(r)
+	}
+	return out, nil
+}
+
+// Count returns the number of allowed IPv4 addresses.
+func (x *PagedIPv4Index) Count() uint64 {
+	return x.total
+}
+
+// Lookup returns the index-th allowed IPv4 address in host byte order.
+func (x *PagedIPv4Index) Lookup(index uint64) (uint32, bool) {
+	if index >= x.total {
+		return 0, false
+	}
+	page := index >> pagedIndexBits
+	lo := int(x.pages[page])
+	hi := len(x.ranges)
+	if page+1 < uint64(len(x.pages)) {
+		hi = int(x.pages[page+1]) + 1
+	}
+	i := lo
+	if x.ranges[lo].CumEnd <= index {
+		i = lo + sort.Search(hi-lo, func(j int) bool {
+			return x.ranges[lo+j].CumEnd > index
+		})
+	}
+	prevCum := uint64(0)
+	if i > 0 {
+		prevCum = x.ranges[i-1].CumEnd
+	}
+	return x.ranges[i].Start + uint32(index-prevCum), true
+}
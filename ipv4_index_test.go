@@ -0,0 +1,160 @@
+package ziterate
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// fragmentedRangeSet returns a set of n small ranges separated by gaps, like
+// the result of subtracting a large fragmented blocklist.
+func fragmentedRangeSet(n int) *IPv4RangeSet {
+	ranges := make([]IPv4Range, n)
+	for i := range ranges {
+		ranges[i].Start = uint32(0x0a000000 + 4*i)
+		ranges[i].End = ranges[i].Start + uint32(i%3)
+	}
+	ranges = withCumulativeCounts(ranges)
+	return &IPv4RangeSet{ranges: ranges, total: ranges[len(ranges)-1].CumEnd}
+}
+
+func TestPagedIPv4IndexMatchesRangeSet(t *testing.T) {
+	sets := map[string]*IPv4RangeSet{
+		"fragmented": fragmentedRangeSet(10000),
+	}
+	for _, entries := range [][]string{
+		{"10.0.0.0/8"},
+		{"10.0.0.0/20", "10.0.16.1", "10.1.0.0/31", "192.0.2.0/24"},
+	} {
+		set, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: entries})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets[entries[0]] = set
+	}
+	for name, set := range sets {
+		t.Run(name, func(t *testing.T) {
+			index, err := NewPagedIPv4Index(set)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index.Count() != set.Count() {
+				t.Fatalf("Count() = %d, want %d", index.Count(), set.Count())
+			}
+			check := func(i uint64) {
+				want, _ := set.Lookup(i)
+				got, ok := index.Lookup(i)
+				if !ok || got != want {
+					t.Fatalf("Lookup(%d) = %#x, %v; want %#x", i, got, ok, want)
+				}
+			}
+			if set.Count() <= 1<<16 {
+				for i := uint64(0); i < set.Count(); i++ {
+					check(i)
+				}
+			} else {
+				r := rand.New(rand.NewPCG(1, 2))
+				for i := 0; i < 1<<16; i++ {
+					check(r.Uint64N(set.Count()))
+				}
+				check(set.Count() - 1)
+			}
+			if _, ok := index.Lookup(set.Count()); ok {
+				t.Fatal("Lookup(Count()) returned true")
+			}
+		})
+	}
+}
+
+func TestPagedIPv4IndexEmpty(t *testing.T) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"0.0.0.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := NewPagedIPv4Index(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.Lookup(0); ok {
+		t.Fatal("Lookup(0) on an empty index returned true")
+	}
+}
+
+func TestTargetIteratorWithPagedIndex(t *testing.T) {
+	allowed := fragmentedRangeSet(5000)
+	index, err := NewPagedIPv4Index(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(5)}
+	plain, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Random = NewSeedReader(5)
+	opts.Index = index
+	paged, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want, ok := plain.Next(); ok; want, ok = plain.Next() {
+		got, gotOK := paged.Next()
+		if !gotOK || got != want {
+			t.Fatalf("paged iterator returned %v, %v; want %v", got, gotOK, want)
+		}
+	}
+
+	other, err := NewPagedIPv4Index(fragmentedRangeSet(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Index = other
+	if _, err := NewTargetIterator(opts); err == nil {
+		t.Fatal("expected error for an index that does not match Allowed")
+	}
+}
+
+func benchmarkLookup(b *testing.B, index IPv4Index) {
+	r := rand.New(rand.NewPCG(1, 2))
+	indexes := make([]uint64, 1<<16)
+	for i := range indexes {
+		indexes[i] = r.Uint64N(index.Count())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := index.Lookup(indexes[i&(len(indexes)-1)]); !ok {
+			b.Fatal("lookup failed")
+		}
+	}
+}
+
+func BenchmarkIPv4RangeSetLookupFragmented(b *testing.B) {
+	benchmarkLookup(b, fragmentedRangeSet(500000))
+}
+
+func BenchmarkPagedIPv4IndexLookupFragmented(b *testing.B) {
+	index, err := NewPagedIPv4Index(fragmentedRangeSet(500000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLookup(b, index)
+}
+
+func BenchmarkIPv4RangeSetLookupFew(b *testing.B) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{BlockEntries: []string{"10.0.0.0/8", "192.168.0.0/16"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLookup(b, set)
+}
+
+func BenchmarkPagedIPv4IndexLookupFew(b *testing.B) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{BlockEntries: []string{"10.0.0.0/8", "192.168.0.0/16"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	index, err := NewPagedIPv4Index(set)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLookup(b, index)
+}
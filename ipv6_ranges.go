@@ -0,0 +1,237 @@
+package ziterate
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+var maxIPv6 = netip.AddrFrom16([16]byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+})
+
+// IPv6Range is an inclusive IPv6 address range. CumEnd is the number of
+// allowed addresses up to and including this range.
+type IPv6Range struct {
+	Start  netip.Addr
+	End    netip.Addr
+	CumEnd *big.Int
+}
+
+// IPv6RangeSet stores sorted, non-overlapping allowed IPv6 ranges.
+type IPv6RangeSet struct {
+	ranges []IPv6Range
+	total  *big.Int
+}
+
+// IPv6RangeSetOptions configures construction of an IPv6RangeSet.
+type IPv6RangeSetOptions struct {
+	AllowEntries []string
+	AllowFiles   []string
+	BlockEntries []string
+	BlockFiles   []string
+
+	// Lenient and OnInvalidLine handle invalid lines as they do in
+	// IPv4RangeSetOptions.
+	Lenient       bool
+	OnInvalidLine func(*RangeParseError)
+}
+
+// NewIPv6RangeSet constructs an IPv6RangeSet from allowlist and blocklist
+// entries. It has the same semantics as NewIPv4RangeSet: if any allowlist
+// source is provided, the set starts empty, otherwise it starts with the full
+// IPv6 address space. Blocklists are then subtracted, and the unspecified
+// address :: is always excluded.
+func NewIPv6RangeSet(opts IPv6RangeSetOptions) (*IPv6RangeSet, error) {
+	hasAllowlist := len(opts.AllowEntries) > 0 || len(opts.AllowFiles) > 0
+	var allowed []IPv6Range
+	if !hasAllowlist {
+		allowed = []IPv6Range{{Start: netip.IPv6Unspecified(), End: maxIPv6}}
+	}
+
+	parse := firstField(parseIPv6Range)
+	errs := &rangeParseErrors{lenient: opts.Lenient, onInvalid: opts.OnInvalidLine}
+	allowRanges, err := parseRangeSources(opts.AllowEntries, opts.AllowFiles, parse, errs)
+	if err != nil {
+		return nil, err
+	}
+	if hasAllowlist {
+		allowed = normalizeIPv6Ranges(allowRanges)
+	}
+
+	blockRanges, err := parseRangeSources(opts.BlockEntries, opts.BlockFiles, parse, errs)
+	if err != nil {
+		return nil, err
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	allowed = subtractIPv6Ranges(allowed, normalizeIPv6Ranges(blockRanges))
+	unspecified := netip.IPv6Unspecified()
+	allowed = subtractIPv6Ranges(allowed, []IPv6Range{{Start: unspecified, End: unspecified}})
+	allowed = withIPv6CumulativeCounts(normalizeIPv6Ranges(allowed))
+
+	total := big.NewInt(0)
+	if len(allowed) > 0 {
+		total.Set(allowed[len(allowed)-1].CumEnd)
+	}
+	return &IPv6RangeSet{ranges: allowed, total: total}, nil
+}
+
+// Count returns the number of allowed IPv6 addresses.
+func (s *IPv6RangeSet) Count() *big.Int {
+	if s == nil {
+		return big.NewInt(0)
+	}
+	return big.NewInt(0).Set(s.total)
+}
+
+// Lookup returns the index-th allowed IPv6 address.
+func (s *IPv6RangeSet) Lookup(index *big.Int) (netip.Addr, bool) {
+	if s == nil || index == nil || index.Sign() < 0 || index.Cmp(s.total) >= 0 {
+		return netip.Addr{}, false
+	}
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].CumEnd.Cmp(index) > 0
+	})
+	if i == len(s.ranges) {
+		return netip.Addr{}, false
+	}
+	offset := big.NewInt(0).Set(index)
+	if i > 0 {
+		offset.Sub(offset, s.ranges[i-1].CumEnd)
+	}
+	return bigIntToIPv6(offset.Add(offset, ipv6ToBigInt(s.ranges[i].Start))), true
+}
+
+// Ranges returns a copy of the allowed IPv6 ranges.
+func (s *IPv6RangeSet) Ranges() []IPv6Range {
+	if s == nil {
+		return nil
+	}
+	out := make([]IPv6Range, len(s.ranges))
+	for i, r := range s.ranges {
+		out[i] = IPv6Range{Start: r.Start, End: r.End, CumEnd: big.NewInt(0).Set(r.CumEnd)}
+	}
+	return out
+}
+
+func parseIPv6Range(entry string) (IPv6Range, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return IPv6Range{}, err
+		}
+		prefix = prefix.Masked()
+		if !prefix.Addr().Is6() {
+			return IPv6Range{}, fmt.Errorf("not an IPv6 prefix: %s", entry)
+		}
+		start := prefix.Addr()
+		size := big.NewInt(1)
+		size.Lsh(size, uint(128-prefix.Bits()))
+		end := size.Add(size, ipv6ToBigInt(start))
+		end.Sub(end, big.NewInt(1))
+		return IPv6Range{Start: start, End: bigIntToIPv6(end)}, nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return IPv6Range{}, err
+	}
+	if !addr.Is6() {
+		return IPv6Range{}, fmt.Errorf("not an IPv6 address: %s", entry)
+	}
+	addr = addr.WithZone("")
+	return IPv6Range{Start: addr, End: addr}, nil
+}
+
+func ipv6ToBigInt(addr netip.Addr) *big.Int {
+	a := addr.As16()
+	return big.NewInt(0).SetBytes(a[:])
+}
+
+func bigIntToIPv6(n *big.Int) netip.Addr {
+	var a [16]byte
+	n.FillBytes(a[:])
+	return netip.AddrFrom16(a)
+}
+
+func normalizeIPv6Ranges(ranges []IPv6Range) []IPv6Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+	out := make([]IPv6Range, 0, len(ranges))
+	sort.Slice(ranges, func(i, j int) bool {
+		if c := ranges[i].Start.Compare(ranges[j].Start); c != 0 {
+			return c < 0
+		}
+		return ranges[i].End.Less(ranges[j].End)
+	})
+	for _, r := range ranges {
+		if r.End.Less(r.Start) {
+			continue
+		}
+		if len(out) == 0 {
+			out = append(out, IPv6Range{Start: r.Start, End: r.End})
+			continue
+		}
+		last := &out[len(out)-1]
+		if r.Start.Compare(last.End) <= 0 || (last.End != maxIPv6 && r.Start == last.End.Next()) {
+			if last.End.Less(r.End) {
+				last.End = r.End
+			}
+			continue
+		}
+		out = append(out, IPv6Range{Start: r.Start, End: r.End})
+	}
+	return out
+}
+
+func subtractIPv6Ranges(allowed, blocked []IPv6Range) []IPv6Range {
+	if len(allowed) == 0 || len(blocked) == 0 {
+		return allowed
+	}
+	blocked = normalizeIPv6Ranges(blocked)
+	out := make([]IPv6Range, 0, len(allowed))
+	blockIdx := 0
+	for _, allow := range normalizeIPv6Ranges(allowed) {
+		start := allow.Start
+		exhausted := false
+		for blockIdx < len(blocked) && blocked[blockIdx].End.Less(start) {
+			blockIdx++
+		}
+		for i := blockIdx; i < len(blocked) && blocked[i].Start.Compare(allow.End) <= 0; i++ {
+			block := blocked[i]
+			if start.Less(block.Start) {
+				out = append(out, IPv6Range{Start: start, End: block.Start.Prev()})
+			}
+			if block.End == maxIPv6 {
+				exhausted = true
+				break
+			}
+			start = block.End.Next()
+			if allow.End.Less(start) {
+				break
+			}
+		}
+		if !exhausted && start.Compare(allow.End) <= 0 {
+			out = append(out, IPv6Range{Start: start, End: allow.End})
+		}
+	}
+	return out
+}
+
+func withIPv6CumulativeCounts(ranges []IPv6Range) []IPv6Range {
+	total := big.NewInt(0)
+	one := big.NewInt(1)
+	for i := range ranges {
+		size := ipv6ToBigInt(ranges[i].End)
+		size.Sub(size, ipv6ToBigInt(ranges[i].Start))
+		size.Add(size, one)
+		total.Add(total, size)
+		ranges[i].CumEnd = big.NewInt(0).Set(total)
+	}
+	return ranges
+}
@@ -0,0 +1,120 @@
+package ziterate
+
+import (
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPv6RangeSetParsingLookupAndZeroExclusion(t *testing.T) {
+	set, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{
+			"# comment-only\n::\n2001:db8::/126 # inline comment\n2001:db8:1::7",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := set.Count(), big.NewInt(5); got.Cmp(want) != 0 {
+		t.Fatalf("Count() = %s, want %s", got, want)
+	}
+	tests := []struct {
+		index int64
+		want  string
+	}{
+		{0, "2001:db8::"},
+		{1, "2001:db8::1"},
+		{3, "2001:db8::3"},
+		{4, "2001:db8:1::7"},
+	}
+	for _, tc := range tests {
+		got, ok := set.Lookup(big.NewInt(tc.index))
+		if !ok {
+			t.Fatalf("Lookup(%d) returned false", tc.index)
+		}
+		if got != netip.MustParseAddr(tc.want) {
+			t.Fatalf("Lookup(%d) = %s, want %s", tc.index, got, tc.want)
+		}
+	}
+	if _, ok := set.Lookup(big.NewInt(5)); ok {
+		t.Fatal("Lookup(5) returned true")
+	}
+}
+
+func TestIPv6RangeSetDefaultFullAndBlockSubtract(t *testing.T) {
+	set, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		BlockEntries: []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := big.NewInt(1)
+	want.Lsh(want, 128)
+	want.Sub(want, big.NewInt(3))
+	if got := set.Count(); got.Cmp(want) != 0 {
+		t.Fatalf("Count() = %s, want %s", got, want)
+	}
+	first, ok := set.Lookup(big.NewInt(0))
+	if !ok || first != netip.MustParseAddr("::1") {
+		t.Fatalf("first allowed = %s, %v; want ::1, true", first, ok)
+	}
+	last, ok := set.Lookup(want.Sub(want, big.NewInt(1)))
+	if !ok || last != netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffd") {
+		t.Fatalf("last allowed = %s, %v", last, ok)
+	}
+}
+
+func TestIPv6RangeSetMergeAndSubtract(t *testing.T) {
+	set, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{"2001:db8::/127", "2001:db8::2", "2001:db8::4"},
+		BlockEntries: []string{"2001:db8::1", "2001:db8::4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := set.Ranges()
+	want := []IPv6Range{
+		{Start: netip.MustParseAddr("2001:db8::"), End: netip.MustParseAddr("2001:db8::"), CumEnd: big.NewInt(1)},
+		{Start: netip.MustParseAddr("2001:db8::2"), End: netip.MustParseAddr("2001:db8::2"), CumEnd: big.NewInt(2)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d ranges, want %d: %#v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Start != want[i].Start || got[i].End != want[i].End || got[i].CumEnd.Cmp(want[i].CumEnd) != 0 {
+			t.Fatalf("range %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIPv6RangeSetFiles(t *testing.T) {
+	dir := t.TempDir()
+	allowFile := filepath.Join(dir, "allow.txt")
+	blockFile := filepath.Join(dir, "block.txt")
+	if err := os.WriteFile(allowFile, []byte("2001:db8::/126\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blockFile, []byte("2001:db8::2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	set, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowFiles: []string{allowFile},
+		BlockFiles: []string{blockFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := set.Count(), big.NewInt(3); got.Cmp(want) != 0 {
+		t.Fatalf("Count() = %s, want %s", got, want)
+	}
+}
+
+func TestIPv6RangeSetRejectsIPv4(t *testing.T) {
+	for _, entry := range []string{"192.0.2.1", "192.0.2.0/24"} {
+		if _, err := NewIPv6RangeSet(IPv6RangeSetOptions{AllowEntries: []string{entry}}); err == nil {
+			t.Fatalf("NewIPv6RangeSet(%q) succeeded", entry)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ziterate
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"math/big"
+	"net/netip"
+)
+
+// IPv6Target is an IPv6 target and optional destination port.
+type IPv6Target struct {
+	IP      netip.Addr
+	Port    uint16
+	HasPort bool
+}
+
+// IPv6TargetIteratorOptions configures an IPv6TargetIterator.
+type IPv6TargetIteratorOptions struct {
+	Allowed    *IPv6RangeSet
+	Ports      TargetPorts
+	Random     io.Reader
+	Shard      uint16
+	Shards     uint16
+	MaxTargets uint64
+
+	// Group, if set, is walked instead of the smallest ZMap group that fits
+	// the target space. P must be greater than the number of targets.
+	Group *Group
+}
+
+// IPv6TargetIterator maps cyclic group elements into allowed IPv6 targets. It
+// is the IPv6 counterpart of TargetIterator, and always walks the group with a
+// BigIntGroupIterator since IPv6 target spaces rarely fit in a uint64.
+type IPv6TargetIterator struct {
+	allowed     *IPv6RangeSet
+	ports       TargetPorts
+	iterator    *BigIntGroupIterator
+	targetSpace *big.Int
+	portCount   *big.Int
+	index       *big.Int
+	ipIndex     *big.Int
+	portIndex   *big.Int
+	shard       uint16
+	shards      uint16
+	seen        uint64
+	emitted     uint64
+	maxTargets  uint64
+}
+
+// NewIPv6TargetIterator constructs an IPv6TargetIterator over the configured
+// allowed addresses and ports.
+func NewIPv6TargetIterator(opts IPv6TargetIteratorOptions) (*IPv6TargetIterator, error) {
+	if opts.Allowed == nil || opts.Allowed.Count().Sign() == 0 {
+		return nil, fmt.Errorf("no allowed targets")
+	}
+	if len(opts.Ports.Ports) == 0 {
+		opts.Ports = TargetPorts{Ports: []uint16{0}}
+	}
+	if opts.Shards == 0 {
+		opts.Shards = 1
+	}
+	if opts.Shard >= opts.Shards {
+		return nil, fmt.Errorf("shard %d must be less than shards %d", opts.Shard, opts.Shards)
+	}
+	portCount := big.NewInt(int64(len(opts.Ports.Ports)))
+	targetSpace := opts.Allowed.Count()
+	targetSpace.Mul(targetSpace, portCount)
+	group, err := groupForBigInt(opts.Group, targetSpace)
+	if err != nil {
+		return nil, err
+	}
+	it, err := BigIntGroupIteratorFromGroup(group, opts.Random)
+	if err != nil {
+		return nil, err
+	}
+	return &IPv6TargetIterator{
+		allowed:     opts.Allowed,
+		ports:       opts.Ports,
+		iterator:    it,
+		targetSpace: targetSpace,
+		portCount:   portCount,
+		index:       big.NewInt(0),
+		ipIndex:     big.NewInt(0),
+		portIndex:   big.NewInt(0),
+		shard:       opts.Shard,
+		shards:      opts.Shards,
+		maxTargets:  opts.MaxTargets,
+	}, nil
+}
+
+// All returns an iterator over the remaining targets. Breaking out of the loop
+// leaves the iterator positioned just after the last target yielded.
+func (it *IPv6TargetIterator) All() iter.Seq[IPv6Target] {
+	return func(yield func(IPv6Target) bool) {
+		for target, ok := it.Next(); ok; target, ok = it.Next() {
+			if !yield(target) {
+				return
+			}
+		}
+	}
+}
+
+// Next returns the next target, or false when iteration is complete.
+func (it *IPv6TargetIterator) Next() (IPv6Target, bool) {
+	if it.maxTargets > 0 && it.emitted >= it.maxTargets {
+		return IPv6Target{}, false
+	}
+	for {
+		value := it.iterator.NextBigInt()
+		if value == nil {
+			return IPv6Target{}, false
+		}
+		if value.Sign() == 0 {
+			continue
+		}
+		it.index.Sub(value, one)
+		if it.index.Cmp(it.targetSpace) >= 0 {
+			continue
+		}
+		it.ipIndex.QuoRem(it.index, it.portCount, it.portIndex)
+		ip, ok := it.allowed.Lookup(it.ipIndex)
+		if !ok {
+			continue
+		}
+		seen := it.seen
+		it.seen++
+		if seen%uint64(it.shards) != uint64(it.shard) {
+			continue
+		}
+		it.emitted++
+		return IPv6Target{
+			IP:      ip,
+			Port:    it.ports.Ports[it.portIndex.Uint64()],
+			HasPort: it.ports.IncludePort,
+		}, true
+	}
+}
@@ -0,0 +1,146 @@
+package ziterate
+
+import (
+	"crypto/rand"
+	"net/netip"
+	"testing"
+)
+
+func TestIPv6TargetIteratorCoversAllTargets(t *testing.T) {
+	allowed, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{"2001:db8::/120", "2001:db8:1::1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewIPv6TargetIterator(IPv6TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{80, 443}, IncludePort: true},
+		Random:  rand.Reader,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[IPv6Target]bool)
+	for target, ok := it.Next(); ok; target, ok = it.Next() {
+		if seen[target] {
+			t.Fatalf("duplicate target %v", target)
+		}
+		seen[target] = true
+	}
+	if got, want := len(seen), 257*2; got != want {
+		t.Fatalf("got %d targets, want %d", got, want)
+	}
+	if !seen[IPv6Target{IP: netip.MustParseAddr("2001:db8:1::1"), Port: 443, HasPort: true}] {
+		t.Fatal("missing 2001:db8:1::1 port 443")
+	}
+}
+
+func TestIPv6TargetIteratorShardingAndMaxTargets(t *testing.T) {
+	allowed, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{"2001:db8::/124"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	union := make(map[netip.Addr]int)
+	for shard := uint16(0); shard < 3; shard++ {
+		it, err := NewIPv6TargetIterator(IPv6TargetIteratorOptions{
+			Allowed: allowed,
+			Random:  NewSeedReader(42),
+			Shard:   shard,
+			Shards:  3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for target, ok := it.Next(); ok; target, ok = it.Next() {
+			union[target.IP]++
+		}
+	}
+	if len(union) != 16 {
+		t.Fatalf("shards covered %d addresses, want 16", len(union))
+	}
+	for ip, n := range union {
+		if n != 1 {
+			t.Fatalf("%s emitted %d times", ip, n)
+		}
+	}
+
+	it, err := NewIPv6TargetIterator(IPv6TargetIteratorOptions{
+		Allowed:    allowed,
+		Random:     rand.Reader,
+		MaxTargets: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+		count++
+	}
+	if count != 5 {
+		t.Fatalf("got %d targets, want 5", count)
+	}
+}
+
+func TestIPv6TargetIteratorAll(t *testing.T) {
+	allowed, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{"2001:db8::/124"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewIPv6TargetIterator(IPv6TargetIteratorOptions{
+		Allowed: allowed,
+		Random:  NewSeedReader(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[IPv6Target]bool)
+	for target := range it.All() {
+		seen[target] = true
+		if len(seen) == 5 {
+			break
+		}
+	}
+	for target := range it.All() {
+		if seen[target] {
+			t.Fatalf("duplicate target %v", target)
+		}
+		seen[target] = true
+	}
+	if len(seen) != 16 {
+		t.Fatalf("got %d targets, want 16", len(seen))
+	}
+}
+
+func TestIPv6TargetIteratorLargePrefix(t *testing.T) {
+	prefix := netip.MustParsePrefix("2001:db8::/32")
+	allowed, err := NewIPv6RangeSet(IPv6RangeSetOptions{AllowEntries: []string{prefix.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewIPv6TargetIterator(IPv6TargetIteratorOptions{
+		Allowed:    allowed,
+		Random:     NewSeedReader(12),
+		MaxTargets: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[netip.Addr]bool)
+	for target := range it.All() {
+		if !prefix.Contains(target.IP) {
+			t.Fatalf("target %s is outside %s", target.IP, prefix)
+		}
+		if seen[target.IP] {
+			t.Fatalf("duplicate target %s", target.IP)
+		}
+		seen[target.IP] = true
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("got %d targets, want 1000", len(seen))
+	}
+}
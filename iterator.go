@@ -1,10 +1,12 @@
 package ziterate
 
 import (
-	"crypto/rand"
 	"fmt"
 	"io"
+	"iter"
+	"math"
 	"math/big"
+	"math/bits"
 )
 
 // BigIntGroupIterator uses a big.Int to Iterate over cyclic groups of arbitrary
@@ -13,8 +15,9 @@ type BigIntGroupIterator struct {
 	g         *Group
 	generator *big.Int
 	start     *big.Int
-	end       *big.Int
 	current   *big.Int
+	position  *big.Int
+	stop      *big.Int
 }
 
 // BigIntGroupIteratorFromGroup constructs a BigIntGroupIterator given any valid
@@ -32,8 +35,9 @@ func BigIntGroupIteratorFromGroup(g *Group, random io.Reader) (*BigIntGroupItera
 		g:         g,
 		generator: generator,
 		start:     big.NewInt(0).Add(big.NewInt(0), start),
-		end:       big.NewInt(0).Add(big.NewInt(0), start),
 		current:   big.NewInt(0).Add(big.NewInt(0), start),
+		position:  big.NewInt(0),
+		stop:      big.NewInt(0).Sub(g.P, one),
 	}
 	return res, nil
 }
@@ -47,14 +51,82 @@ func (it *BigIntGroupIterator) NextBigInt() *big.Int {
 	}
 	it.current.Mul(it.current, it.generator)
 	it.current.Mod(it.current, it.g.P)
+	it.position.Add(it.position, one)
 
 	out := it.current
-	if it.current.Cmp(it.end) == 0 {
+	if it.position.Cmp(it.stop) >= 0 {
 		it.current = nil
 	}
 	return out
 }
 
+// All returns an iterator over the remaining elements of the cycle. Like
+// NextBigInt, it may reuse the yielded *big.Int for the next element, so
+// callers that keep elements must copy them. Breaking out of the loop leaves
+// the iterator positioned just after the last element yielded.
+func (it *BigIntGroupIterator) All() iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		for x := it.NextBigInt(); x != nil; x = it.NextBigInt() {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+// Seek positions the iterator so that the next element returned is the
+// (k+1)-th element of the cycle, start * generator^(k+1) mod P. Seeking to or
+// beyond the end of the cycle completes the iterator. Seek does not walk the
+// cycle and takes time logarithmic in k.
+func (it *BigIntGroupIterator) Seek(k *big.Int) {
+	if k.Cmp(it.stop) >= 0 {
+		it.position = big.NewInt(0).Set(it.stop)
+		it.current = nil
+		return
+	}
+	it.position = big.NewInt(0).Set(k)
+	it.current = big.NewInt(0).Exp(it.generator, k, it.g.P)
+	it.current.Mul(it.current, it.start)
+	it.current.Mod(it.current, it.g.P)
+}
+
+// limit ends the cycle after position stop instead of after P - 1.
+func (it *BigIntGroupIterator) limit(stop *big.Int) {
+	it.stop = big.NewInt(0).Sub(it.g.P, one)
+	if stop.Cmp(it.stop) < 0 {
+		it.stop.Set(stop)
+	}
+	if it.position.Cmp(it.stop) >= 0 {
+		it.Seek(it.stop)
+	}
+}
+
+// clone returns an independent copy of the iterator.
+func (it *BigIntGroupIterator) clone() *BigIntGroupIterator {
+	out := &BigIntGroupIterator{
+		g:         it.g,
+		generator: big.NewInt(0).Set(it.generator),
+		start:     big.NewInt(0).Set(it.start),
+		position:  big.NewInt(0).Set(it.position),
+		stop:      big.NewInt(0).Set(it.stop),
+	}
+	if it.current != nil {
+		out.current = big.NewInt(0).Set(it.current)
+	}
+	return out
+}
+
+// Skip advances the iterator by n elements without returning them.
+func (it *BigIntGroupIterator) Skip(n *big.Int) {
+	it.Seek(big.NewInt(0).Add(it.position, n))
+}
+
+// Position returns the number of elements the iterator has moved through
+// since the start of the cycle.
+func (it *BigIntGroupIterator) Position() *big.Int {
+	return big.NewInt(0).Set(it.position)
+}
+
 // Next implements the Iterator interface.
 func (it *BigIntGroupIterator) Next() interface{} {
 	out := it.NextBigInt()
@@ -71,8 +143,9 @@ type UintGroupIterator struct {
 	prime     uint64
 	generator uint32
 	start     uint64
-	end       uint64
 	current   uint64
+	position  uint64
+	stop      uint64
 }
 
 const (
@@ -116,14 +189,14 @@ func UintGroupIteratorFromGroup(g *Group, random io.Reader) (*UintGroupIterator,
 		prime:     p,
 		generator: generator,
 		start:     start.Uint64(),
-		end:       start.Uint64(),
 		current:   start.Uint64(),
+		stop:      p - 1,
 	}, nil
 }
 
 func randomNonZeroBigInt(random io.Reader, max *big.Int) (*big.Int, error) {
 	limit := big.NewInt(0).Sub(max, big.NewInt(1))
-	out, err := rand.Int(random, limit)
+	out, err := randomBelow(random, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -139,13 +212,88 @@ func (it *UintGroupIterator) NextUint() uint64 {
 	}
 	it.current *= uint64(it.generator)
 	it.current %= it.prime
+	it.position++
 	out := it.current
-	if it.current == it.end {
+	if it.position >= it.stop {
 		it.current = 0
 	}
 	return out
 }
 
+// All returns an iterator over the remaining elements of the cycle. Breaking
+// out of the loop leaves the iterator positioned just after the last element
+// yielded.
+func (it *UintGroupIterator) All() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for x := it.NextUint(); x != 0; x = it.NextUint() {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+// Seek positions the iterator so that the next element returned is the
+// (k+1)-th element of the cycle, start * generator^(k+1) mod P. Seeking to or
+// beyond the end of the cycle completes the iterator. Seek does not walk the
+// cycle and takes time logarithmic in k.
+func (it *UintGroupIterator) Seek(k uint64) {
+	if k >= it.stop {
+		it.position = it.stop
+		it.current = 0
+		return
+	}
+	it.position = k
+	it.current = mulMod(powMod(uint64(it.generator), k, it.prime), it.start, it.prime)
+}
+
+// limit ends the cycle after position stop instead of after P - 1.
+func (it *UintGroupIterator) limit(stop uint64) {
+	it.stop = min(stop, it.prime-1)
+	if it.position >= it.stop {
+		it.Seek(it.stop)
+	}
+}
+
+// clone returns an independent copy of the iterator.
+func (it *UintGroupIterator) clone() *UintGroupIterator {
+	out := *it
+	return &out
+}
+
+// Skip advances the iterator by n elements without returning them.
+func (it *UintGroupIterator) Skip(n uint64) {
+	k, carry := bits.Add64(it.position, n, 0)
+	if carry != 0 {
+		k = math.MaxUint64
+	}
+	it.Seek(k)
+}
+
+// Position returns the number of elements the iterator has moved through
+// since the start of the cycle.
+func (it *UintGroupIterator) Position() uint64 {
+	return it.position
+}
+
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, m)
+}
+
+func powMod(base, exp, m uint64) uint64 {
+	out := uint64(1) % m
+	base %= m
+	for exp > 0 {
+		if exp&1 == 1 {
+			out = mulMod(out, base, m)
+		}
+		base = mulMod(base, base, m)
+		exp >>= 1
+	}
+	return out
+}
+
 // Next implements the Iterator interface.
 func (it *UintGroupIterator) Next() interface{} {
 	out := it.NextUint()
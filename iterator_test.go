@@ -101,6 +101,85 @@ func TestUintGroupIteratorZMapGroupBounds(t *testing.T) {
 	}
 }
 
+func TestUintGroupIteratorSeekAndSkip(t *testing.T) {
+	g := ZMapGroups[1]
+	it, err := UintGroupIteratorFromGroup(g, NewSeedReader(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sequence []uint64
+	for x := it.NextUint(); x != 0; x = it.NextUint() {
+		sequence = append(sequence, x)
+	}
+	if uint64(len(sequence)) != it.Position() {
+		t.Fatalf("Position() = %d after %d elements", it.Position(), len(sequence))
+	}
+
+	seeker, err := UintGroupIteratorFromGroup(g, NewSeedReader(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []uint64{0, 1, 1000, 65534, 12, 65535} {
+		seeker.Seek(k)
+		if got := seeker.Position(); got != k {
+			t.Fatalf("Position() after Seek(%d) = %d", k, got)
+		}
+		if got, want := seeker.NextUint(), sequence[k]; got != want {
+			t.Fatalf("element after Seek(%d) = %d, want %d", k, got, want)
+		}
+	}
+	seeker.Seek(100)
+	seeker.Skip(50)
+	if got, want := seeker.NextUint(), sequence[150]; got != want {
+		t.Fatalf("element after Skip = %d, want %d", got, want)
+	}
+	seeker.Skip(1 << 63)
+	if got := seeker.NextUint(); got != 0 {
+		t.Fatalf("element after skipping past the end = %d, want 0", got)
+	}
+	seeker.Seek(uint64(len(sequence) - 1))
+	if got, want := seeker.NextUint(), sequence[len(sequence)-1]; got != want {
+		t.Fatalf("last element = %d, want %d", got, want)
+	}
+	if got := seeker.NextUint(); got != 0 {
+		t.Fatalf("element after last = %d, want 0", got)
+	}
+}
+
+func TestBigIntGroupIteratorSeekAndSkip(t *testing.T) {
+	g := ZMapGroups[1]
+	it, err := BigIntGroupIteratorFromGroup(g, NewSeedReader(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sequence []string
+	for x := it.NextBigInt(); x != nil; x = it.NextBigInt() {
+		sequence = append(sequence, x.String())
+	}
+
+	seeker, err := BigIntGroupIteratorFromGroup(g, NewSeedReader(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []int64{0, 1, 1000, 65534, 12} {
+		seeker.Seek(big.NewInt(k))
+		if got := seeker.Position(); got.Int64() != k {
+			t.Fatalf("Position() after Seek(%d) = %s", k, got)
+		}
+		if got, want := seeker.NextBigInt().String(), sequence[k]; got != want {
+			t.Fatalf("element after Seek(%d) = %s, want %s", k, got, want)
+		}
+	}
+	seeker.Skip(big.NewInt(50))
+	if got, want := seeker.NextBigInt().String(), sequence[63]; got != want {
+		t.Fatalf("element after Skip = %s, want %s", got, want)
+	}
+	seeker.Seek(big.NewInt(65536))
+	if got := seeker.NextBigInt(); got != nil {
+		t.Fatalf("element after seeking past the end = %s, want nil", got)
+	}
+}
+
 func BenchmarkIteratorFullBigInt(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		g := ZMapGroups[0]
@@ -212,3 +291,81 @@ func BenchmarkIteratorNextUint64Interface(b *testing.B) {
 		}
 	}
 }
+
+func TestUintGroupIteratorAll(t *testing.T) {
+	g := ZMapGroups[0]
+	it, err := UintGroupIteratorFromGroup(g, NewSeedReader(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := UintGroupIteratorFromGroup(g, NewSeedReader(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for x := range it.All() {
+		if w := want.NextUint(); x != w {
+			t.Fatalf("element %d = %d, want %d", count, x, w)
+		}
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	if it.Position() != 10 {
+		t.Fatalf("Position() after break = %d, want 10", it.Position())
+	}
+	for x := range it.All() {
+		if w := want.NextUint(); x != w {
+			t.Fatalf("element %d = %d, want %d", count, x, w)
+		}
+		count++
+	}
+	if uint64(count) != g.P.Uint64()-1 {
+		t.Fatalf("got %d elements, want %d", count, g.P.Uint64()-1)
+	}
+}
+
+func TestBigIntGroupIteratorAll(t *testing.T) {
+	g := ZMapGroups[0]
+	it, err := BigIntGroupIteratorFromGroup(g, NewSeedReader(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := BigIntGroupIteratorFromGroup(g, NewSeedReader(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for x := range it.All() {
+		if w := want.NextBigInt(); x.Cmp(w) != 0 {
+			t.Fatalf("element %d = %s, want %s", count, x, w)
+		}
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	if it.Position().Uint64() != 10 {
+		t.Fatalf("Position() after break = %s, want 10", it.Position())
+	}
+	for range it.All() {
+		count++
+	}
+	if uint64(count) != g.P.Uint64()-1 {
+		t.Fatalf("got %d elements, want %d", count, g.P.Uint64()-1)
+	}
+}
+
+func BenchmarkIteratorFullUint64All(b *testing.B) {
+	g := largestUintGroup()
+	for i := 0; i < b.N; i++ {
+		it, err := UintGroupIteratorFromGroup(g, rand.Reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		it.limit(1 << 20)
+		for range it.All() {
+		}
+	}
+}
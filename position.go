@@ -0,0 +1,184 @@
+package ziterate
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// TargetPosition is where a target falls in a TargetIterator's walk.
+type TargetPosition struct {
+	// CycleIndex is the position in the underlying cycle at which the target
+	// is produced: after Seek(CycleIndex), the next element of the cycle is
+	// the target.
+	CycleIndex uint64
+	// Index is the target's index in the iterator's target space.
+	Index uint64
+	// Shard is the shard that produces the target.
+	Shard uint16
+}
+
+// PositionOf returns the position of target in the walk, and the shard that
+// produces it, for the same options used to construct the iterator. It does
+// not change the iterator's position.
+//
+// For iterators backed by a cyclic group, the position is a discrete
+// logarithm, which is computed with the Pohlig-Hellman algorithm from the
+// group's OrderFactors. PositionOf returns an error before doing any work for
+// groups where P - 1 has a prime factor above 2^44. Of the ZMapGroups, that
+// rejects 2^64 + 13 and every group from 2^80 + 13 up, and groups from
+// GenerateGroup may be rejected too. When sharding by count between several
+// shards, the shard depends on how many targets come earlier in the cycle, so
+// PositionOf walks the cycle up to the target, which takes time proportional
+// to CycleIndex.
+//
+// PositionOf is not supported for ZMapCompatible or sampling iterators, or for
+// custom iterators other than UintGroupIterator and FeistelIterator.
+func (it *TargetIterator) PositionOf(target Target) (TargetPosition, error) {
+	if it.zmap != nil {
+		return TargetPosition{}, fmt.Errorf("cannot locate targets of a ZMap compatible iterator")
+	}
+	if it.sample != nil {
+		return TargetPosition{}, fmt.Errorf("cannot locate targets of a sampling iterator")
+	}
+	var err error
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		err = v.g.checkDiscreteLog()
+	case *BigIntGroupIterator:
+		err = v.g.checkDiscreteLog()
+	}
+	if err != nil {
+		return TargetPosition{}, err
+	}
+	index, err := it.targetIndex(target)
+	if err != nil {
+		return TargetPosition{}, err
+	}
+	element := index + 1
+	var cycleIndex uint64
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		generator := big.NewInt(int64(v.generator))
+		start := big.NewInt(0).SetUint64(v.start)
+		cycleIndex, err = groupPosition(v.g, generator, start, element)
+	case *BigIntGroupIterator:
+		cycleIndex, err = groupPosition(v.g, v.generator, v.start, element)
+	case *FeistelIterator:
+		cycleIndex = v.inverse(index)
+	default:
+		err = fmt.Errorf("iterator %T does not support locating targets", it.source())
+	}
+	if err != nil {
+		return TargetPosition{}, err
+	}
+	shard, err := it.shardOf(cycleIndex)
+	if err != nil {
+		return TargetPosition{}, err
+	}
+	return TargetPosition{CycleIndex: cycleIndex, Index: index, Shard: shard}, nil
+}
+
+// targetIndex returns the index of target in the target space, the inverse of
+// the mapping in NextRecord.
+func (it *TargetIterator) targetIndex(target Target) (uint64, error) {
+	addr := Uint32ToIPv4(target.IP)
+	ipIndex, ok := it.allowed.IndexOf(target.IP)
+	if !ok {
+		return 0, fmt.Errorf("%s is not an allowed address", addr)
+	}
+	if target.HasPort != it.ports.IncludePort {
+		if it.ports.IncludePort {
+			return 0, fmt.Errorf("target %s needs a port", addr)
+		}
+		return 0, fmt.Errorf("target %s has a port, but the iterator's targets do not", addr)
+	}
+	portIndex := 0
+	if target.HasPort {
+		portIndex = slices.Index(it.ports.Ports, target.Port)
+		if portIndex < 0 {
+			return 0, fmt.Errorf("port %d is not a target port", target.Port)
+		}
+	}
+	return ipIndex*uint64(len(it.ports.Ports)) + uint64(portIndex), nil
+}
+
+// groupPosition returns the position at which a walk of g with the given
+// generator and start produces element.
+func groupPosition(g *Group, generator, start *big.Int, element uint64) (uint64, error) {
+	// The walk produces start*generator^p at position p - 1, and start
+	// itself last, at position P - 2.
+	h := big.NewInt(0).ModInverse(start, g.P)
+	h.Mul(h, big.NewInt(0).SetUint64(element))
+	h.Mod(h, g.P)
+	x, err := g.discreteLog(generator, h)
+	if err != nil {
+		return 0, err
+	}
+	// A group with a wrong P or factor list can give a wrong logarithm, so
+	// check it.
+	check := big.NewInt(0).Exp(generator, x, g.P)
+	check.Mul(check, start)
+	check.Mod(check, g.P)
+	if !check.IsUint64() || check.Uint64() != element {
+		return 0, fmt.Errorf("discrete logarithm of %d modulo %s is wrong: check the group's order factors", element, g.P)
+	}
+	if x.Sign() == 0 {
+		x.Sub(g.P, one)
+	}
+	x.Sub(x, one)
+	if !x.IsUint64() {
+		return 0, fmt.Errorf("position %s does not fit in a uint64", x)
+	}
+	return x.Uint64(), nil
+}
+
+// shardOf returns the shard that produces the element at the given position of
+// the cycle.
+func (it *TargetIterator) shardOf(cycleIndex uint64) (uint16, error) {
+	if it.shards <= 1 {
+		return 0, nil
+	}
+	if it.sharding == ShardByCycle {
+		length, _ := it.cycleLength()
+		for shard := uint16(0); shard < it.shards; shard++ {
+			if _, end := shardCycleRange(length, shard, it.shards); cycleIndex < end {
+				return shard, nil
+			}
+		}
+		return 0, fmt.Errorf("position %d is beyond the end of the cycle", cycleIndex)
+	}
+	// Count the targets that come before cycleIndex, on a copy of the cycle.
+	walk := *it
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		walk.iterator = v.clone()
+	case *BigIntGroupIterator:
+		walk.iterator = bigUintIterator{v.clone()}
+	case *FeistelIterator:
+		walk.iterator = v.clone()
+	}
+	walk.limitCycle(0, cycleIndex)
+	seen := uint64(0)
+	for value := walk.iterator.NextUint(); value != 0; value = walk.iterator.NextUint() {
+		if value-1 < it.targetSpace {
+			seen++
+		}
+	}
+	return uint16(seen % uint64(it.shards)), nil
+}
+
+// cycleLength returns the length of the full underlying cycle, as in
+// restrictToShard.
+func (it *TargetIterator) cycleLength() (uint64, bool) {
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		return cycleLength(v.g)
+	case *BigIntGroupIterator:
+		return cycleLength(v.g)
+	case *FeistelIterator:
+		return v.n, true
+	default:
+		return 0, false
+	}
+}
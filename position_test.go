@@ -0,0 +1,179 @@
+package ziterate
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestTargetIteratorPositionOf(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/24"},
+		BlockEntries: []string{"10.0.0.64/28"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := TargetPorts{Ports: []uint16{80, 443}, IncludePort: true}
+	const shards = 3
+	for _, ordering := range []Ordering{OrderByGroup, OrderByFeistel} {
+		for _, sharding := range []ShardMode{ShardByCount, ShardByCycle} {
+			opts := TargetIteratorOptions{
+				Allowed:  allowed,
+				Ports:    ports,
+				Random:   NewSeedReader(16),
+				Shards:   shards,
+				Sharding: sharding,
+				Ordering: ordering,
+			}
+			locator, err := NewTargetIterator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := 0
+			for shard := uint16(0); shard < shards; shard++ {
+				opts.Random = NewSeedReader(16)
+				opts.Shard = shard
+				it, err := NewTargetIterator(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for record, ok := it.NextRecord(); ok; record, ok = it.NextRecord() {
+					seen++
+					position, err := locator.PositionOf(record.Target)
+					if err != nil {
+						t.Fatalf("%s/%s: PositionOf(%+v) returned error: %v", ordering, sharding, record.Target, err)
+					}
+					if position.Shard != shard || position.Index != record.Index {
+						t.Fatalf("%s/%s: PositionOf(%+v) = %+v, want shard %d and index %d", ordering, sharding, record.Target, position, shard, record.Index)
+					}
+
+					opts := opts
+					opts.Random = NewSeedReader(16)
+					opts.Shard, opts.Shards = 0, 1
+					single, err := NewTargetIterator(opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := single.Seek(position.CycleIndex); err != nil {
+						t.Fatal(err)
+					}
+					if got, ok := single.Next(); !ok || got != record.Target {
+						t.Fatalf("%s/%s: Next() after Seek(%d) = %+v, %v, want %+v", ordering, sharding, position.CycleIndex, got, ok, record.Target)
+					}
+				}
+			}
+			if want := int(allowed.Count()) * len(ports.Ports); seen != want {
+				t.Fatalf("%s/%s: shards produced %d targets, want %d", ordering, sharding, seen, want)
+			}
+		}
+	}
+}
+
+func TestTargetIteratorPositionOfBigIntGroup(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, err := ParseTargetPorts("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TargetIteratorOptions{Allowed: allowed, Ports: ports, Random: NewSeedReader(16)}
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := it.source().(*BigIntGroupIterator); !ok {
+		t.Fatalf("iterator is a %T, want a *BigIntGroupIterator", it.source())
+	}
+	for _, want := range []Target{
+		{IP: 0x01020304, Port: 443, HasPort: true},
+		{IP: 0xffffffff, Port: 22, HasPort: true},
+	} {
+		position, err := it.PositionOf(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := it.Seek(position.CycleIndex); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := it.Next(); !ok || got != want {
+			t.Fatalf("Next() after Seek(%d) = %+v, %v, want %+v", position.CycleIndex, got, ok, want)
+		}
+	}
+}
+
+func TestTargetIteratorPositionOfErrors(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := TargetPorts{Ports: []uint16{80}, IncludePort: true}
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Ports: ports, Random: NewSeedReader(16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []Target{
+		{IP: 0x0b000001, Port: 80, HasPort: true},
+		{IP: 0x0a000001, Port: 81, HasPort: true},
+		{IP: 0x0a000001},
+	} {
+		if _, err := it.PositionOf(target); err == nil {
+			t.Fatalf("PositionOf(%+v) returned nil error", target)
+		}
+	}
+
+	// P - 1 of the group for 2^64 + 13 has a prime factor above 2^44, which
+	// is reported before the target is even looked up.
+	var large *Group
+	for _, g := range ZMapGroups {
+		if g.P.BitLen() == 65 {
+			large = g
+		}
+	}
+	infeasible, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Ports: ports, Group: large, Random: NewSeedReader(16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = infeasible.PositionOf(Target{IP: 0x0b000001, Port: 80, HasPort: true})
+	if err == nil || !strings.Contains(err.Error(), "too large to compute discrete logarithms") {
+		t.Fatalf("PositionOf() with the group for 2^64 + 13 returned %v", err)
+	}
+
+	custom, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Iterator: &sequenceIterator{values: []uint64{1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := custom.PositionOf(Target{IP: 0x0a000001}); err == nil {
+		t.Fatal("PositionOf() on a custom iterator returned nil error")
+	}
+
+	zmap, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, ZMapCompatible: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zmap.PositionOf(Target{IP: 0x0a000001}); err == nil {
+		t.Fatal("PositionOf() on a ZMap compatible iterator returned nil error")
+	}
+}
+
+func TestGroupPositionChecksLogarithm(t *testing.T) {
+	// The factor list is missing 5, so discreteLog only finds the logarithm
+	// modulo 206.
+	g := &Group{
+		P:            big.NewInt(1031),
+		KnownRoot:    big.NewInt(14),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(103)},
+	}
+	failed := false
+	for element := uint64(1); element < 1031; element++ {
+		if _, err := groupPosition(g, g.KnownRoot, big.NewInt(3), element); err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		t.Fatal("groupPosition() accepted every logarithm in a group with missing order factors")
+	}
+}
@@ -0,0 +1,66 @@
+package ziterate
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// presetFiles holds the built-in blocklists, one file per preset, in the same
+// format as blocklist files.
+//
+//go:embed presets/*.txt
+var presetFiles embed.FS
+
+// IPv4PresetNames returns the names of the built-in IPv4 blocklists, which
+// can be excluded with IPv4RangeSetOptions.ExcludePresets:
+//
+//   - "private": the RFC 1918 private-use networks.
+//   - "multicast": 224.0.0.0/4.
+//   - "reserved": 0.0.0.0/8, 240.0.0.0/4 and the limited broadcast address.
+//   - "documentation": the three TEST-NET networks.
+//   - "iana-special": every block in the IANA IPv4 Special-Purpose Address
+//     Registry, which includes the private, reserved and documentation
+//     presets, but not multicast.
+func IPv4PresetNames() []string {
+	entries, err := fs.ReadDir(presetFiles, "presets")
+	if err != nil {
+		panic(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".txt"))
+	}
+	return names
+}
+
+// IPv4Preset returns the addresses in the named built-in blocklist. Each
+// address is labeled with the name and RFC of its block.
+func IPv4Preset(name string) (*IPv4RangeSet, error) {
+	ranges, err := presetRanges(name)
+	if err != nil {
+		return nil, err
+	}
+	set := rangeSetFrom(ranges)
+	set.labels = labelsFrom(ranges)
+	return set, nil
+}
+
+func presetRanges(name string) ([]IPv4Range, error) {
+	if !slices.Contains(IPv4PresetNames(), name) {
+		return nil, fmt.Errorf("unknown preset: %s", name)
+	}
+	file, err := presetFiles.Open("presets/" + name + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	errs := &rangeParseErrors{}
+	ranges, err := parseRangeLines(file, "preset "+name, ipv4LineParser(nil), errs)
+	if err != nil {
+		return nil, err
+	}
+	return ranges, errs.err()
+}
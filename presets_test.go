@@ -0,0 +1,64 @@
+package ziterate
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestIPv4PresetNames(t *testing.T) {
+	want := []string{"documentation", "iana-special", "multicast", "private", "reserved"}
+	if got := IPv4PresetNames(); !slices.Equal(got, want) {
+		t.Fatalf("IPv4PresetNames() = %v, want %v", got, want)
+	}
+}
+
+func TestIPv4Presets(t *testing.T) {
+	special, err := IPv4Preset("iana-special")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range IPv4PresetNames() {
+		preset, err := IPv4Preset(name)
+		if err != nil {
+			t.Fatalf("IPv4Preset(%q) returned error: %v", name, err)
+		}
+		if preset.Count() == 0 {
+			t.Fatalf("preset %s is empty", name)
+		}
+		// Every preset other than multicast is part of the special-purpose
+		// registry.
+		inSpecial := preset.Subtract(special).Count() == 0
+		if inSpecial != (name != "multicast") {
+			t.Fatalf("preset %s: contained in iana-special = %v", name, inSpecial)
+		}
+	}
+	if _, err := IPv4Preset("bogus"); err == nil {
+		t.Fatal("IPv4Preset(bogus) returned nil error")
+	}
+}
+
+func TestIPv4RangeSetExcludePresets(t *testing.T) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		ExcludePresets: []string{"iana-special", "multicast"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excluded := []string{"10.1.2.3", "100.64.0.1", "127.0.0.1", "169.254.1.1", "172.31.255.255", "192.168.1.1", "192.0.2.1", "198.18.0.1", "224.0.0.1", "239.255.255.255", "240.0.0.1", "255.255.255.255", "0.1.2.3"}
+	allowed := []string{"1.1.1.1", "8.8.8.8", "100.63.255.255", "100.128.0.0", "172.32.0.0", "223.255.255.255"}
+	for _, addr := range excluded {
+		if set.ContainsAddr(netip.MustParseAddr(addr)) {
+			t.Fatalf("%s was not excluded", addr)
+		}
+	}
+	for _, addr := range allowed {
+		if !set.ContainsAddr(netip.MustParseAddr(addr)) {
+			t.Fatalf("%s was excluded", addr)
+		}
+	}
+
+	if _, err := NewIPv4RangeSet(IPv4RangeSetOptions{ExcludePresets: []string{"public"}}); err == nil {
+		t.Fatal("expected error for an unknown preset")
+	}
+}
@@ -1,14 +1,123 @@
 package ziterate
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math/big"
 	mathrand "math/rand"
+	randv2 "math/rand/v2"
 )
 
-// This file only exists because we don't want to import "crypto/rand" and
-// "math/rand" in another file possibly, because math/rand is usually the devil.
+// This file holds everything that turns a seed into random bytes, and random
+// bytes into group elements. The rest of the package only reads from the
+// io.Reader it is given, so seeded orderings cannot change unless this file
+// does.
 
-// NewSeedReader returns a deterministic random reader for repeatable iteration.
+// SeedVersion selects how a seed is turned into random bytes. Each version is
+// fixed once released: a given seed, version and group always select the same
+// generator and start element. TestSeedReaderGolden guards the outputs.
+type SeedVersion int
+
+const (
+	// SeedVersionMathRand reads from a math/rand source seeded with the seed.
+	// It was the only derivation before seeds were versioned, and is kept to
+	// reproduce those orderings. Its output depends on the math/rand
+	// implementation.
+	SeedVersionMathRand SeedVersion = 0
+
+	// SeedVersion1 reads from ChaCha8, as specified by C2SP chacha8rand and
+	// implemented by math/rand/v2. The ChaCha8 seed is 32 bytes of
+	// HKDF-SHA256 output, with the seed as 8 little-endian bytes for the
+	// input key material, no salt, and "ziterate seed v1" as the info.
+	SeedVersion1 SeedVersion = 1
+)
+
+// seedInfoV1 is the HKDF info string for SeedVersion1.
+const seedInfoV1 = "ziterate seed v1"
+
+// String returns the name used for the version by ParseSeedVersion.
+func (v SeedVersion) String() string {
+	switch v {
+	case SeedVersionMathRand:
+		return "mathrand"
+	case SeedVersion1:
+		return "1"
+	default:
+		return fmt.Sprintf("SeedVersion(%d)", int(v))
+	}
+}
+
+// ParseSeedVersion parses a seed version name: "1" or "mathrand".
+func ParseSeedVersion(s string) (SeedVersion, error) {
+	switch s {
+	case "mathrand", "0":
+		return SeedVersionMathRand, nil
+	case "1":
+		return SeedVersion1, nil
+	default:
+		return 0, fmt.Errorf("unknown seed version: %s", s)
+	}
+}
+
+// NewSeedReader returns a deterministic random reader for repeatable
+// iteration, using SeedVersion1.
 func NewSeedReader(seed uint64) io.Reader {
-	return mathrand.New(mathrand.NewSource(int64(seed)))
+	r, err := NewSeedReaderVersion(seed, SeedVersion1)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// NewSeedReaderVersion returns a deterministic random reader for repeatable
+// iteration, using the given derivation.
+func NewSeedReaderVersion(seed uint64, version SeedVersion) (io.Reader, error) {
+	switch version {
+	case SeedVersionMathRand:
+		return mathrand.New(mathrand.NewSource(int64(seed))), nil
+	case SeedVersion1:
+		var ikm [8]byte
+		binary.LittleEndian.PutUint64(ikm[:], seed)
+		key, err := hkdf.Key(sha256.New, ikm[:], nil, seedInfoV1, 32)
+		if err != nil {
+			return nil, err
+		}
+		return randv2.NewChaCha8([32]byte(key)), nil
+	default:
+		return nil, fmt.Errorf("unknown seed version: %d", int(version))
+	}
+}
+
+// randomBelow returns a uniform random integer in [0, max). It reads
+// ceil(bits(max - 1) / 8) bytes at a time as a big-endian integer, clears the
+// bits above bits(max - 1), and retries until the result is below max. This
+// is the algorithm of crypto/rand.Int, copied so that seeded orderings do not
+// depend on it.
+func randomBelow(random io.Reader, max *big.Int) (*big.Int, error) {
+	if max.Sign() <= 0 {
+		return nil, fmt.Errorf("random bound %s is not positive", max)
+	}
+	n := big.NewInt(0).Sub(max, one)
+	bitLen := n.BitLen()
+	if bitLen == 0 {
+		return n, nil
+	}
+	buf := make([]byte, (bitLen+7)/8)
+	topBits := uint(bitLen % 8)
+	if topBits == 0 {
+		topBits = 8
+	}
+	for {
+		if _, err := io.ReadFull(random, buf); err != nil {
+			return nil, err
+		}
+		buf[0] &= uint8(1<<topBits - 1)
+		n.SetBytes(buf)
+		if n.Cmp(max) < 0 {
+			return n, nil
+		}
+	}
 }
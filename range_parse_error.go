@@ -0,0 +1,92 @@
+package ziterate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RangeParseError describes an invalid line in an allowlist or blocklist.
+type RangeParseError struct {
+	// File is the path of the file the line came from, or empty for an entry
+	// given directly, such as IPv4RangeSetOptions.AllowEntries.
+	File string
+	// Line is the 1-based line number within the file or entry.
+	Line int
+	// Column is the 1-based byte offset of the entry within the line.
+	Column int
+	// Text is the line as it was read, including any comment.
+	Text string
+	// Err is the reason the line is invalid.
+	Err error
+}
+
+func (e *RangeParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %v: %q", e.Line, e.Column, e.Err, e.Text)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v: %q", e.File, e.Line, e.Column, e.Err, e.Text)
+}
+
+func (e *RangeParseError) Unwrap() error {
+	return e.Err
+}
+
+// RangeParseErrors is every invalid line found while constructing a range set.
+type RangeParseErrors []*RangeParseError
+
+// maxReportedRangeErrors is the number of invalid lines listed by
+// RangeParseErrors.Error.
+const maxReportedRangeErrors = 10
+
+// Error lists the first few invalid lines, one per line, and how many more
+// there are.
+func (e RangeParseErrors) Error() string {
+	var b strings.Builder
+	for i, err := range e {
+		if i == maxReportedRangeErrors {
+			fmt.Fprintf(&b, "\n... and %d more invalid lines", len(e)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e RangeParseErrors) Unwrap() []error {
+	out := make([]error, len(e))
+	for i, err := range e {
+		out[i] = err
+	}
+	return out
+}
+
+// rangeParseErrors collects the invalid lines from every source of a range
+// set.
+type rangeParseErrors struct {
+	lenient   bool
+	onInvalid func(*RangeParseError)
+	errs      RangeParseErrors
+}
+
+// add records an invalid line.
+func (c *rangeParseErrors) add(err *RangeParseError) {
+	if c.lenient {
+		if c.onInvalid != nil {
+			c.onInvalid(err)
+		}
+		return
+	}
+	c.errs = append(c.errs, err)
+}
+
+// err returns the invalid lines, or nil if there were none or they were
+// skipped.
+func (c *rangeParseErrors) err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
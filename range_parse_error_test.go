@@ -0,0 +1,100 @@
+package ziterate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRangeParseErrors(t *testing.T) {
+	dir := t.TempDir()
+	allowFile := filepath.Join(dir, "allow.txt")
+	blockFile := filepath.Join(dir, "block.txt")
+	if err := os.WriteFile(allowFile, []byte("10.0.0.0/24\n  10.0.1.300 # typo\n10.0.2.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blockFile, []byte("# header\n\n10.0.0.9-10.0.0.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"192.0.2.0/24\nbogus/8"},
+		AllowFiles:   []string{allowFile},
+		BlockFiles:   []string{blockFile},
+	})
+	var errs RangeParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want RangeParseErrors", err)
+	}
+	want := []RangeParseError{
+		{File: "", Line: 2, Column: 1, Text: "bogus/8"},
+		{File: allowFile, Line: 2, Column: 3, Text: "  10.0.1.300 # typo"},
+		{File: blockFile, Line: 3, Column: 1, Text: "10.0.0.9-10.0.0.1"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), err)
+	}
+	for i, w := range want {
+		got := errs[i]
+		if got.File != w.File || got.Line != w.Line || got.Column != w.Column || got.Text != w.Text || got.Err == nil {
+			t.Fatalf("error %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if got, want := errs[1].Error(), fmt.Sprintf("%s:2:3: %v: %q", allowFile, errs[1].Err, errs[1].Text); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+	var parseErr *RangeParseError
+	if !errors.As(err, &parseErr) || parseErr != errs[0] {
+		t.Fatalf("errors.As(*RangeParseError) = %v, want the first error", parseErr)
+	}
+}
+
+func TestRangeParseErrorsTruncated(t *testing.T) {
+	lines := strings.Repeat("nope\n", 25)
+	_, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{lines}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	message := err.Error()
+	if got := strings.Count(message, "\n"); got != maxReportedRangeErrors {
+		t.Fatalf("error has %d lines, want %d: %s", got+1, maxReportedRangeErrors+1, message)
+	}
+	if !strings.HasSuffix(message, "and 15 more invalid lines") {
+		t.Fatalf("error = %s, want it to end with the number of unlisted lines", message)
+	}
+}
+
+func TestRangeSetLenient(t *testing.T) {
+	var skipped []*RangeParseError
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries:  []string{"10.0.0.0/24\n10.0.0.256\n10.0.1.0/24"},
+		BlockEntries:  []string{"nope\n10.0.0.1"},
+		Lenient:       true,
+		OnInvalidLine: func(err *RangeParseError) { skipped = append(skipped, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := set.Count(), uint64(511); got != want {
+		t.Fatalf("Count() = %d, want %d", got, want)
+	}
+	if len(skipped) != 2 || skipped[0].Text != "10.0.0.256" || skipped[1].Text != "nope" {
+		t.Fatalf("skipped = %v, want the two invalid lines", skipped)
+	}
+
+	set6, err := NewIPv6RangeSet(IPv6RangeSetOptions{
+		AllowEntries: []string{"2001:db8::/126\n2001:db8::/129"},
+		Lenient:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := set6.Count().Int64(); got != 4 {
+		t.Fatalf("IPv6 Count() = %d, want 4", got)
+	}
+	if _, err := NewIPv6RangeSet(IPv6RangeSetOptions{AllowEntries: []string{"2001:db8::/129"}}); !errors.As(err, new(*RangeParseError)) {
+		t.Fatalf("IPv6 error = %v, want a RangeParseError", err)
+	}
+}
@@ -0,0 +1,172 @@
+package ziterate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for a TokenBucket. Tests can substitute a clock
+// that advances only when Sleep is called.
+type Clock interface {
+	Now() time.Time
+	// Sleep returns after d has passed, or with ctx's error if ctx is done
+	// first.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TokenBucket paces events to a rate. The bucket holds up to burst tokens and
+// refills at rate tokens per second, and each event takes one token, so events
+// may exceed the rate by up to burst at a time but never on average. It starts
+// full. A TokenBucket is safe for concurrent use, so the iterators returned by
+// Split can share one to limit their combined rate.
+type TokenBucket struct {
+	mu     sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a TokenBucket with the given rate, in events per
+// second, and burst. A nil clock means SystemClock.
+func NewTokenBucket(rate float64, burst int, clock Clock) (*TokenBucket, error) {
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return nil, fmt.Errorf("invalid rate: %v", rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("burst must be at least 1, got %d", burst)
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &TokenBucket{
+		clock:  clock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}, nil
+}
+
+// Wait takes a token, first sleeping until one is available. If ctx is done
+// before then, Wait returns its error and the token is returned to the bucket.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Take the token now, even if that leaves the bucket in debt, and sleep
+	// until the debt is repaid. Concurrent callers queue up behind each
+	// other's debt rather than racing for each new token.
+	b.mu.Lock()
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(math.Ceil(-b.tokens / b.rate * float64(time.Second)))
+	}
+	b.mu.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	if err := b.clock.Sleep(ctx, wait); err != nil {
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Ethernet framing that ZMap adds to a packet's length when converting a
+// bandwidth to a packet rate: the 7-byte preamble, 1-byte start frame
+// delimiter, 4-byte frame check sequence and 12-byte inter-frame gap, with
+// frames padded to the 84-byte minimum.
+const (
+	ethernetOverhead = 24
+	minEthernetFrame = 84
+)
+
+// RateForBandwidth returns the packet rate, in packets per second, that uses
+// bitsPerSecond of Ethernet bandwidth with packets of packetSize bytes, as
+// ZMap computes it for --bandwidth.
+func RateForBandwidth(bitsPerSecond float64, packetSize int) float64 {
+	frame := max(packetSize+ethernetOverhead, minEthernetFrame)
+	return bitsPerSecond / float64(8*frame)
+}
+
+// RateLimitedIterator paces the targets of a TargetIterator with a
+// TokenBucket, for feeding them straight into a sender.
+type RateLimitedIterator struct {
+	it     *TargetIterator
+	bucket *TokenBucket
+	// pending is a target taken from it whose wait was canceled.
+	pending    TargetRecord
+	hasPending bool
+}
+
+// NewRateLimitedIterator returns an iterator that returns the targets of it no
+// faster than bucket allows.
+func NewRateLimitedIterator(it *TargetIterator, bucket *TokenBucket) *RateLimitedIterator {
+	return &RateLimitedIterator{it: it, bucket: bucket}
+}
+
+// Next waits for a token and returns the next target. It returns false once
+// the underlying iterator is exhausted, without waiting. If ctx is done while
+// waiting, Next returns ctx's error, and the target it was waiting to return
+// is returned by the next call instead.
+func (r *RateLimitedIterator) Next(ctx context.Context) (Target, bool, error) {
+	record, ok, err := r.NextRecord(ctx)
+	return record.Target, ok, err
+}
+
+// NextRecord is Next, returning the target's TargetRecord.
+func (r *RateLimitedIterator) NextRecord(ctx context.Context) (TargetRecord, bool, error) {
+	if !r.hasPending {
+		record, ok := r.it.NextRecord()
+		if !ok {
+			return TargetRecord{}, false, nil
+		}
+		r.pending, r.hasPending = record, true
+	}
+	if err := r.bucket.Wait(ctx); err != nil {
+		return TargetRecord{}, false, err
+	}
+	r.hasPending = false
+	return r.pending, true, nil
+}
+
+// Pending returns the target that a canceled call to Next or NextRecord took
+// from the underlying iterator but did not return, if any. A caller that stops
+// early can send it before checkpointing the underlying iterator, which has
+// already moved past it.
+func (r *RateLimitedIterator) Pending() (TargetRecord, bool) {
+	return r.pending, r.hasPending
+}
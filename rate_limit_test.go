@@ -0,0 +1,203 @@
+package ziterate
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only advances when Sleep is called.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	bucket, err := NewTokenBucket(10, 3, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.now
+	var times []time.Duration
+	for i := 0; i < 6; i++ {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, clock.now.Sub(start))
+	}
+	// The burst goes out at once, and then one event every 100ms.
+	ms := time.Millisecond
+	want := []time.Duration{0, 0, 0, 100 * ms, 200 * ms, 300 * ms}
+	for i := range want {
+		if times[i] != want[i] {
+			t.Fatalf("event times = %v, want %v", times, want)
+		}
+	}
+
+	// An idle second refills the bucket, but only up to the burst.
+	clock.now = clock.now.Add(time.Second)
+	clock.sleeps = nil
+	for i := 0; i < 4; i++ {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 100*ms {
+		t.Fatalf("sleeps after idling = %v, want [100ms]", clock.sleeps)
+	}
+}
+
+func TestTokenBucketAverageRate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket, err := NewTokenBucket(12345, 100, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.now
+	const events = 100000
+	for i := 0; i < events; i++ {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := clock.now.Sub(start).Seconds()
+	want := float64(events-100) / 12345
+	if math.Abs(elapsed-want) > 1e-3 {
+		t.Fatalf("%d events took %vs, want %vs", events, elapsed, want)
+	}
+}
+
+func TestTokenBucketCanceled(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket, err := NewTokenBucket(1, 1, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := bucket.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := bucket.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait after cancel = %v, want %v", err, context.Canceled)
+	}
+	if err := bucket.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != time.Second {
+		t.Fatalf("sleeps = %v, want [1s]", clock.sleeps)
+	}
+}
+
+func TestNewTokenBucketErrors(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := NewTokenBucket(rate, 1, nil); err == nil {
+			t.Fatalf("NewTokenBucket(%v, 1) succeeded", rate)
+		}
+	}
+	if _, err := NewTokenBucket(1, 0, nil); err == nil {
+		t.Fatal("NewTokenBucket with burst 0 succeeded")
+	}
+}
+
+func TestRateForBandwidth(t *testing.T) {
+	tests := []struct {
+		bandwidth  float64
+		packetSize int
+		want       float64
+	}{
+		// Small packets are padded to the minimum Ethernet frame.
+		{bandwidth: 672000, packetSize: 54, want: 1000},
+		{bandwidth: 1e9, packetSize: 1476, want: 1e9 / 12000},
+	}
+	for _, test := range tests {
+		if got := RateForBandwidth(test.bandwidth, test.packetSize); got != test.want {
+			t.Fatalf("RateForBandwidth(%v, %d) = %v, want %v", test.bandwidth, test.packetSize, got, test.want)
+		}
+	}
+}
+
+func TestRateLimitedIterator(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"192.0.2.0/29"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{0}},
+		Random:  NewSeedReader(4),
+	}
+	plain, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collectTargets(plain)
+
+	opts.Random = NewSeedReader(4)
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket, err := NewTokenBucket(4, 2, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := NewRateLimitedIterator(it, bucket)
+	start := clock.now
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []Target
+	for {
+		target, ok, err := limited.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, target)
+		if len(got) == 3 {
+			// A canceled wait keeps its target for the next call.
+			cancel()
+			if _, _, err := limited.Next(ctx); err != context.Canceled {
+				t.Fatalf("Next after cancel = %v, want %v", err, context.Canceled)
+			}
+			if pending, ok := limited.Pending(); !ok || pending.Target != want[3] {
+				t.Fatalf("Pending() = %v, %v, want %v", pending.Target, ok, want[3])
+			}
+			ctx = context.Background()
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("target %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	// 8 targets at 4 per second after a burst of 2, with no wait to find the
+	// end.
+	if elapsed := clock.now.Sub(start); elapsed != 1500*time.Millisecond {
+		t.Fatalf("iteration took %v, want 1.5s", elapsed)
+	}
+	if _, ok := limited.Pending(); ok {
+		t.Fatal("Pending() returned a target after iteration ended")
+	}
+}
@@ -0,0 +1,186 @@
+package ziterate
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// StratifiedSample configures a TargetIterator to sample targets from each
+// line of the allowlist, rather than taking the first targets of the walk,
+// which samples each line in proportion to its size. Each line is a stratum
+// of its allowed addresses, after the blocklist is subtracted, even if it is
+// adjacent to another line or the blocklist splits it. Lines are numbered in
+// the order they are read: AllowEntries, then AllowFiles, counting invalid
+// lines skipped with Lenient. As with labels, an address on several lines
+// belongs to the line whose range starts first. Sets without an allowlist,
+// and sets returned by Union, Intersect, Subtract and Complement, have one
+// stratum per range of IPv4RangeSet.Ranges instead.
+//
+// Each range's quota is decided up front, and the iterator keeps the first
+// targets of each range in the order of the walk until its quota is filled.
+// The sample therefore comes from the same pseudorandom permutation as an
+// unsampled walk, and is reproducible with the same seed.
+type StratifiedSample struct {
+	// Total is the number of targets to sample across all ranges.
+	Total uint64
+
+	// Minimum is the number of targets sampled from each line, or every
+	// target of a smaller line. Minimums are met even if they add up to
+	// more than Total.
+	Minimum uint64
+
+	// Weights, if set, has one weight per line, and the targets left over
+	// after the minimums are divided between lines in proportion to them.
+	// Otherwise they are divided in proportion to the lines' sizes.
+	Weights []float64
+}
+
+// sampleQuotas returns the number of targets to sample from each stratum,
+// given the number of targets in each.
+func sampleQuotas(sizes []uint64, s StratifiedSample) ([]uint64, error) {
+	weights := s.Weights
+	if weights == nil {
+		weights = make([]float64, len(sizes))
+		for i, size := range sizes {
+			weights[i] = float64(size)
+		}
+	}
+	if len(weights) != len(sizes) {
+		return nil, fmt.Errorf("got %d sample weights for %d allowlist lines", len(weights), len(sizes))
+	}
+	for _, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid sample weight: %v", w)
+		}
+	}
+
+	quotas := make([]uint64, len(sizes))
+	given := uint64(0)
+	for i, size := range sizes {
+		quotas[i] = min(size, s.Minimum)
+		given += quotas[i]
+	}
+	remaining := uint64(0)
+	if s.Total > given {
+		remaining = s.Total - given
+	}
+	// Divide what remains in proportion to the weights of the ranges that
+	// still have targets to give, until it is used up or no range can take
+	// more. Shares are rounded down, and once rounding leaves nothing to
+	// share, the rest go one at a time to the heaviest ranges.
+	for remaining > 0 {
+		var open []int
+		total := 0.0
+		for i := range sizes {
+			if quotas[i] < sizes[i] && weights[i] > 0 {
+				open = append(open, i)
+				total += weights[i]
+			}
+		}
+		if len(open) == 0 {
+			break
+		}
+		shared := uint64(0)
+		for _, i := range open {
+			share := uint64(float64(remaining) * (weights[i] / total))
+			share = min(share, sizes[i]-quotas[i], remaining-shared)
+			quotas[i] += share
+			shared += share
+		}
+		if shared > 0 {
+			remaining -= shared
+			continue
+		}
+		slices.SortStableFunc(open, func(a, b int) int {
+			switch {
+			case weights[a] > weights[b]:
+				return -1
+			case weights[a] < weights[b]:
+				return 1
+			default:
+				return 0
+			}
+		})
+		for _, i := range open {
+			if remaining == 0 {
+				break
+			}
+			quotas[i]++
+			remaining--
+		}
+	}
+	return quotas, nil
+}
+
+// sampler tracks how much of each stratum's quota a TargetIterator has used.
+type sampler struct {
+	// entries holds the addresses of each stratum, sorted by address.
+	entries   []ipv4Entry
+	quotas    []uint64
+	taken     []uint64
+	remaining uint64
+}
+
+// newSampler returns a sampler for the strata of allowed, each with ports
+// targets per address.
+func newSampler(allowed *IPv4RangeSet, ports int, s StratifiedSample) (*sampler, error) {
+	entries, strata := allowed.strata()
+	sizes := make([]uint64, strata)
+	for _, e := range entries {
+		sizes[e.Line] += (uint64(e.End) - uint64(e.Start) + 1) * uint64(ports)
+	}
+	quotas, err := sampleQuotas(sizes, s)
+	if err != nil {
+		return nil, err
+	}
+	out := &sampler{entries: entries, quotas: quotas, taken: make([]uint64, len(quotas))}
+	for _, q := range quotas {
+		out.remaining += q
+	}
+	return out, nil
+}
+
+// strata returns the allowed addresses of each allowlist line, and the number
+// of lines, or one stratum per range for sets without per-line data.
+func (s *IPv4RangeSet) strata() ([]ipv4Entry, int) {
+	if s.lines > 0 {
+		return s.entries, s.lines
+	}
+	out := make([]ipv4Entry, len(s.ranges))
+	for i, r := range s.ranges {
+		out[i] = ipv4Entry{Start: r.Start, End: r.End, Line: i}
+	}
+	return out, len(out)
+}
+
+// take reports whether a target at ip is part of the sample, and counts it
+// if it is.
+func (s *sampler) take(ip uint32) bool {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].End >= ip
+	})
+	if i == len(s.entries) || s.entries[i].Start > ip {
+		return false
+	}
+	stratum := s.entries[i].Line
+	if s.taken[stratum] >= s.quotas[stratum] {
+		return false
+	}
+	s.taken[stratum]++
+	s.remaining--
+	return true
+}
+
+// done reports whether every quota has been filled.
+func (s *sampler) done() bool {
+	return s.remaining == 0
+}
+
+// clone returns an independent copy of the sampler.
+func (s *sampler) clone() *sampler {
+	out := *s
+	out.taken = slices.Clone(s.taken)
+	return &out
+}
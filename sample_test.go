@@ -0,0 +1,288 @@
+package ziterate
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSampleQuotas(t *testing.T) {
+	tests := []struct {
+		name   string
+		sizes  []uint64
+		sample StratifiedSample
+		want   []uint64
+	}{
+		{
+			name:   "proportional",
+			sizes:  []uint64{100, 300},
+			sample: StratifiedSample{Total: 40},
+			want:   []uint64{10, 30},
+		},
+		{
+			name:   "minimum",
+			sizes:  []uint64{1000, 10},
+			sample: StratifiedSample{Total: 50, Minimum: 5},
+			want:   []uint64{45, 5},
+		},
+		{
+			name:   "minimum above size",
+			sizes:  []uint64{1000, 2},
+			sample: StratifiedSample{Total: 10, Minimum: 5},
+			want:   []uint64{8, 2},
+		},
+		{
+			name:   "minimums above total",
+			sizes:  []uint64{10, 10, 10},
+			sample: StratifiedSample{Total: 4, Minimum: 2},
+			want:   []uint64{2, 2, 2},
+		},
+		{
+			name:   "weights",
+			sizes:  []uint64{100, 100, 100},
+			sample: StratifiedSample{Total: 30, Weights: []float64{1, 2, 0}},
+			want:   []uint64{10, 20, 0},
+		},
+		{
+			name:   "weights capped by size",
+			sizes:  []uint64{5, 100},
+			sample: StratifiedSample{Total: 50, Weights: []float64{1, 1}},
+			want:   []uint64{5, 45},
+		},
+		{
+			name:   "rounding",
+			sizes:  []uint64{10, 10, 10},
+			sample: StratifiedSample{Total: 2},
+			want:   []uint64{1, 1, 0},
+		},
+		{
+			name:   "total above space",
+			sizes:  []uint64{3, 4},
+			sample: StratifiedSample{Total: 100},
+			want:   []uint64{3, 4},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := sampleQuotas(test.sizes, test.sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("sampleQuotas(%v, %+v) = %v, want %v", test.sizes, test.sample, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSampleQuotasErrors(t *testing.T) {
+	for _, weights := range [][]float64{
+		{1},
+		{1, -1},
+		{1, math.NaN()},
+		{math.Inf(1), 1},
+	} {
+		if _, err := sampleQuotas([]uint64{10, 10}, StratifiedSample{Total: 5, Weights: weights}); err == nil {
+			t.Fatalf("sampleQuotas with weights %v succeeded", weights)
+		}
+	}
+}
+
+func sampleTestOptions(t *testing.T, seed uint64, sample StratifiedSample) TargetIteratorOptions {
+	t.Helper()
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/16", "192.0.2.0/24", "198.51.100.7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{80, 443}, IncludePort: true},
+		Random:  NewSeedReader(seed),
+		Sample:  &sample,
+	}
+}
+
+func TestTargetIteratorStratifiedSample(t *testing.T) {
+	opts := sampleTestOptions(t, 5, StratifiedSample{Total: 100, Minimum: 10})
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := collectTargets(it)
+	if len(targets) != 100 {
+		t.Fatalf("sampled %d targets, want 100", len(targets))
+	}
+	perRange := make(map[int]int)
+	seen := make(map[Target]bool)
+	for _, target := range targets {
+		if seen[target] {
+			t.Fatalf("target %v sampled twice", target)
+		}
+		seen[target] = true
+		i, ok := opts.Allowed.rangeOf(target.IP)
+		if !ok {
+			t.Fatalf("sampled target %v is not allowed", target)
+		}
+		perRange[i]++
+	}
+	// The /24 gets its minimum, and the single address both of its targets.
+	want := map[int]int{0: 88, 1: 10, 2: 2}
+	for i, n := range want {
+		if perRange[i] != n {
+			t.Fatalf("sampled %d targets from range %d, want %d (all: %v)", perRange[i], i, n, perRange)
+		}
+	}
+
+	again, err := NewTargetIterator(sampleTestOptions(t, 5, StratifiedSample{Total: 100, Minimum: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(collectTargets(again), targets) {
+		t.Fatal("the same seed sampled different targets")
+	}
+	other, err := NewTargetIterator(sampleTestOptions(t, 6, StratifiedSample{Total: 100, Minimum: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Equal(collectTargets(other), targets) {
+		t.Fatal("different seeds sampled the same targets")
+	}
+}
+
+func TestTargetIteratorStratifiedSampleByLine(t *testing.T) {
+	// 10.1.0.0/30 is adjacent to 10.0.0.0/16, and the blocklist splits
+	// 192.168.0.0/24 in two, but each line is still one stratum.
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/16", "10.1.0.0/30", "192.168.0.0/24"},
+		BlockEntries: []string{"192.168.0.128/26"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(allowed.Ranges()); n != 3 {
+		t.Fatalf("allowed set has %d ranges, want 3", n)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{0}},
+		Random:  NewSeedReader(3),
+		Sample:  &StratifiedSample{Total: 9, Minimum: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	perLine := make(map[string]int)
+	for _, target := range collectTargets(it) {
+		switch {
+		case target.IP>>16 == 0x0a00:
+			perLine["10.0.0.0/16"]++
+		case target.IP>>2 == 0x0a010000>>2:
+			perLine["10.1.0.0/30"]++
+		case target.IP>>8 == 0xc0a800:
+			perLine["192.168.0.0/24"]++
+		}
+	}
+	for _, line := range []string{"10.0.0.0/16", "10.1.0.0/30", "192.168.0.0/24"} {
+		if perLine[line] != 3 {
+			t.Fatalf("sampled %v per line, want 3 from each", perLine)
+		}
+	}
+
+	weighted, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{0}},
+		Random:  NewSeedReader(3),
+		Sample:  &StratifiedSample{Total: 4, Weights: []float64{0, 1, 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range collectTargets(weighted) {
+		if target.IP>>2 != 0x0a010000>>2 {
+			t.Fatalf("sampled %s from a line with weight 0", Uint32ToIPv4(target.IP))
+		}
+	}
+}
+
+func TestEntriesFrom(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/24", "10.0.0.128/25", "10.0.0.200-10.0.1.9", "nonsense", "10.0.1.10"},
+		BlockEntries: []string{"10.0.0.5"},
+		Lenient:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, lines := allowed.strata()
+	want := []ipv4Entry{
+		{Start: 0x0a000000, End: 0x0a000004, Line: 0},
+		{Start: 0x0a000006, End: 0x0a0000ff, Line: 0},
+		{Start: 0x0a000100, End: 0x0a000109, Line: 2},
+		{Start: 0x0a00010a, End: 0x0a00010a, Line: 4},
+	}
+	if lines != 5 || !slices.Equal(entries, want) {
+		t.Fatalf("strata() = %+v, %d, want %+v, 5", entries, lines, want)
+	}
+}
+
+func TestTargetIteratorStratifiedSampleShards(t *testing.T) {
+	sample := StratifiedSample{Total: 60, Weights: []float64{1, 1, 1}}
+	whole, err := NewTargetIterator(sampleTestOptions(t, 9, sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collectTargets(whole)
+
+	got := make(map[Target]int)
+	for shard := uint16(0); shard < 3; shard++ {
+		opts := sampleTestOptions(t, 9, sample)
+		opts.Shard, opts.Shards = shard, 3
+		it, err := NewTargetIterator(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts, err := it.Split(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for target, n := range collectConcurrently(t, parts) {
+			got[target] += n
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("shards sampled %d targets, want %d", len(got), len(want))
+	}
+	for _, target := range want {
+		if got[target] != 1 {
+			t.Fatalf("target %v sampled %d times across shards", target, got[target])
+		}
+	}
+}
+
+func TestTargetIteratorStratifiedSampleErrors(t *testing.T) {
+	opts := sampleTestOptions(t, 1, StratifiedSample{Total: 10})
+	opts.Sharding = ShardByCycle
+	if _, err := NewTargetIterator(opts); err == nil {
+		t.Fatal("sampling with ShardByCycle succeeded")
+	}
+	opts = sampleTestOptions(t, 1, StratifiedSample{Total: 10, Weights: []float64{1}})
+	if _, err := NewTargetIterator(opts); err == nil {
+		t.Fatal("sampling with too few weights succeeded")
+	}
+
+	it, err := NewTargetIterator(sampleTestOptions(t, 1, StratifiedSample{Total: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Seek(3); err == nil {
+		t.Fatal("Seek on a sampling iterator succeeded")
+	}
+	if _, err := it.Checkpoint(); err == nil {
+		t.Fatal("Checkpoint on a sampling iterator succeeded")
+	}
+	if _, err := it.PositionOf(Target{IP: 0x0a000001, Port: 80, HasPort: true}); err == nil {
+		t.Fatal("PositionOf on a sampling iterator succeeded")
+	}
+}
@@ -0,0 +1,98 @@
+package ziterate
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// Split divides the targets that remain in the iterator's shard between n new
+// iterators, for example one per sender goroutine. Together the iterators
+// return every remaining target exactly once. They share no mutable state, so
+// each can be driven from its own goroutine. Any MaxTargets limit is divided
+// between them as evenly as possible.
+//
+// When sharding by cycle, each iterator walks its own contiguous stretch of the
+// shard's remaining cycle. When sharding by count, every iterator walks the
+// whole remaining cycle and keeps every n-th target of the shard, so prefer
+// ShardByCycle when splitting large target spaces.
+//
+// The iterator must not be used after calling Split.
+func (it *TargetIterator) Split(n int) ([]*TargetIterator, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot split into %d iterators", n)
+	}
+	if it.split {
+		return nil, fmt.Errorf("iterator has already been split")
+	}
+	position, err := it.Position()
+	if err != nil {
+		return nil, err
+	}
+	remaining := uint64(0)
+	if it.maxTargets > 0 && it.emitted < it.maxTargets {
+		remaining = it.maxTargets - it.emitted
+	}
+	out := make([]*TargetIterator, n)
+	for i := range out {
+		child := *it
+		child.emitted = 0
+		child.split = true
+		if it.sample != nil {
+			child.sample = it.sample.clone()
+		}
+		switch v := it.source().(type) {
+		case *UintGroupIterator:
+			child.iterator = v.clone()
+		case *BigIntGroupIterator:
+			child.iterator = bigUintIterator{v.clone()}
+		case *FeistelIterator:
+			child.iterator = v.clone()
+		default:
+			return nil, fmt.Errorf("iterator %T does not support splitting", it.source())
+		}
+		if it.sharding == ShardByCycle {
+			span := it.cycleEnd - position
+			begin := position + splitBound(span, uint64(i), uint64(n))
+			end := position + splitBound(span, uint64(i+1), uint64(n))
+			child.cycleBegin, child.cycleEnd = begin, end
+			child.limitCycle(begin, end)
+		} else {
+			child.thread, child.threads = uint64(i), uint64(n)
+		}
+		if it.maxTargets > 0 {
+			child.maxTargets = remaining / uint64(n)
+			if uint64(i) < remaining%uint64(n) {
+				child.maxTargets++
+			}
+			if child.maxTargets == 0 {
+				child.limitCycle(child.cycleEnd, child.cycleEnd)
+			}
+		}
+		out[i] = &child
+	}
+	return out, nil
+}
+
+// splitBound returns the start of the i-th of n equal parts of span.
+func splitBound(span, i, n uint64) uint64 {
+	hi, lo := bits.Mul64(span, i)
+	q, _ := bits.Div64(hi, lo, n)
+	return q
+}
+
+// limitCycle positions the underlying group iterator at begin and ends it at
+// end. The iterator must be a UintGroupIterator or BigIntGroupIterator.
+func (it *TargetIterator) limitCycle(begin, end uint64) {
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		v.limit(end)
+		v.Seek(begin)
+	case *BigIntGroupIterator:
+		v.limit(big.NewInt(0).SetUint64(end))
+		v.Seek(big.NewInt(0).SetUint64(begin))
+	case *FeistelIterator:
+		v.limit(end)
+		v.Seek(begin)
+	}
+}
@@ -0,0 +1,145 @@
+package ziterate
+
+import (
+	"sync"
+	"testing"
+)
+
+func splitTestOptions(t *testing.T, sharding ShardMode) TargetIteratorOptions {
+	t.Helper()
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/21", "192.0.2.0/24"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TargetIteratorOptions{
+		Allowed:  allowed,
+		Ports:    TargetPorts{Ports: []uint16{22, 80, 443}, IncludePort: true},
+		Random:   NewSeedReader(17),
+		Shard:    1,
+		Shards:   3,
+		Sharding: sharding,
+	}
+}
+
+func collectTargets(it *TargetIterator) []Target {
+	var out []Target
+	for target, ok := it.Next(); ok; target, ok = it.Next() {
+		out = append(out, target)
+	}
+	return out
+}
+
+func collectConcurrently(t *testing.T, iterators []*TargetIterator) map[Target]int {
+	t.Helper()
+	results := make([][]Target, len(iterators))
+	var wg sync.WaitGroup
+	for i, it := range iterators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = collectTargets(it)
+		}()
+	}
+	wg.Wait()
+	out := make(map[Target]int)
+	for _, targets := range results {
+		for _, target := range targets {
+			out[target]++
+		}
+	}
+	return out
+}
+
+func TestTargetIteratorSplitCoversShardOnce(t *testing.T) {
+	for _, sharding := range []ShardMode{ShardByCount, ShardByCycle} {
+		t.Run(sharding.String(), func(t *testing.T) {
+			whole, err := NewTargetIterator(splitTestOptions(t, sharding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := collectTargets(whole)
+
+			it, err := NewTargetIterator(splitTestOptions(t, sharding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Consume a few targets first, so Split has to start mid-cycle.
+			for i := 0; i < 7; i++ {
+				it.Next()
+			}
+			parts, err := it.Split(4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := collectConcurrently(t, parts)
+			if len(got) != len(want)-7 {
+				t.Fatalf("split iterators emitted %d targets, want %d", len(got), len(want)-7)
+			}
+			for _, target := range want[:7] {
+				if got[target] != 0 {
+					t.Fatalf("%v was emitted again after Split", target)
+				}
+			}
+			for _, target := range want[7:] {
+				if got[target] != 1 {
+					t.Fatalf("%v emitted %d times, want 1", target, got[target])
+				}
+			}
+		})
+	}
+}
+
+func TestTargetIteratorSplitMaxTargets(t *testing.T) {
+	for _, sharding := range []ShardMode{ShardByCount, ShardByCycle} {
+		t.Run(sharding.String(), func(t *testing.T) {
+			opts := splitTestOptions(t, sharding)
+			opts.MaxTargets = 10
+			it, err := NewTargetIterator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			it.Next()
+			parts, err := it.Split(12)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := 0
+			for i, part := range parts {
+				n := len(collectTargets(part))
+				if i >= 9 && n != 0 {
+					t.Fatalf("iterator %d emitted %d targets, want 0", i, n)
+				}
+				total += n
+			}
+			if total != 9 {
+				t.Fatalf("split iterators emitted %d targets, want 9", total)
+			}
+		})
+	}
+}
+
+func TestTargetIteratorSplitErrors(t *testing.T) {
+	it, err := NewTargetIterator(splitTestOptions(t, ShardByCycle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Split(0); err == nil {
+		t.Error("expected error splitting into zero iterators")
+	}
+	parts, err := it.Split(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parts[0].Split(2); err == nil {
+		t.Error("expected error splitting twice")
+	}
+	if _, err := parts[0].Checkpoint(); err == nil {
+		t.Error("expected error checkpointing a split iterator")
+	}
+	custom := &TargetIterator{iterator: &sequenceIterator{}, shards: 1}
+	if _, err := custom.Split(2); err == nil {
+		t.Error("expected error splitting a custom iterator")
+	}
+}
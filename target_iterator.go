@@ -3,6 +3,7 @@ package ziterate
 import (
 	"fmt"
 	"io"
+	"iter"
 	"math"
 	"math/big"
 	"math/bits"
@@ -15,6 +16,114 @@ type Target struct {
 	HasPort bool
 }
 
+// TargetRecord is a Target along with where it came from.
+type TargetRecord struct {
+	Target
+	// Index is the target's index in the iterator's target space.
+	Index uint64
+	// Shard is the shard of the iterator that produced the target.
+	Shard uint16
+	// Label is the label of the target's address in the allowed set, if
+	// any. See IPv4RangeSet.Label.
+	Label string
+}
+
+// ShardMode selects how a TargetIterator divides targets between shards.
+type ShardMode int
+
+const (
+	// ShardByCount walks the whole cycle in every shard, and keeps every
+	// Shards-th allowed target. It is the default.
+	ShardByCount ShardMode = iota
+
+	// ShardByCycle gives every shard its own contiguous stretch of the cycle,
+	// reached by jumping through the generator, similar to how ZMap divides
+	// the cycle between shards. Each shard only walks its share of the group.
+	// Shards may emit different numbers of targets, since allowed targets are
+	// not spread evenly across the cycle.
+	ShardByCycle
+)
+
+// String returns the name used for the mode by ParseShardMode.
+func (m ShardMode) String() string {
+	switch m {
+	case ShardByCount:
+		return "count"
+	case ShardByCycle:
+		return "cycle"
+	default:
+		return fmt.Sprintf("ShardMode(%d)", int(m))
+	}
+}
+
+// ParseShardMode parses a shard mode name: "count" or "cycle".
+func ParseShardMode(s string) (ShardMode, error) {
+	switch s {
+	case "count":
+		return ShardByCount, nil
+	case "cycle":
+		return ShardByCycle, nil
+	default:
+		return 0, fmt.Errorf("unknown shard mode: %s", s)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m ShardMode) MarshalText() ([]byte, error) {
+	if m != ShardByCount && m != ShardByCycle {
+		return nil, fmt.Errorf("unknown shard mode: %d", int(m))
+	}
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *ShardMode) UnmarshalText(text []byte) error {
+	mode, err := ParseShardMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Ordering selects how a TargetIterator permutes the target space.
+type Ordering int
+
+const (
+	// OrderByGroup walks a cyclic group of prime order, like ZMap. It is the
+	// default.
+	OrderByGroup Ordering = iota
+
+	// OrderByFeistel walks a FeistelIterator over exactly the target space,
+	// so no elements are wasted when the target space is far below the next
+	// group prime.
+	OrderByFeistel
+)
+
+// String returns the name used for the ordering by ParseOrdering.
+func (o Ordering) String() string {
+	switch o {
+	case OrderByGroup:
+		return "group"
+	case OrderByFeistel:
+		return "feistel"
+	default:
+		return fmt.Sprintf("Ordering(%d)", int(o))
+	}
+}
+
+// ParseOrdering parses an ordering name: "group" or "feistel".
+func ParseOrdering(s string) (Ordering, error) {
+	switch s {
+	case "group":
+		return OrderByGroup, nil
+	case "feistel":
+		return OrderByFeistel, nil
+	default:
+		return 0, fmt.Errorf("unknown ordering: %s", s)
+	}
+}
+
 // TargetIteratorOptions configures a TargetIterator.
 type TargetIteratorOptions struct {
 	Allowed    *IPv4RangeSet
@@ -22,20 +131,69 @@ type TargetIteratorOptions struct {
 	Random     io.Reader
 	Shard      uint16
 	Shards     uint16
+	Sharding   ShardMode
 	MaxTargets uint64
+
+	// Ordering selects how the target space is permuted. OrderByFeistel
+	// cannot be combined with Group, and its iterators cannot be
+	// checkpointed.
+	Ordering Ordering
+
+	// Group, if set, is walked instead of the smallest ZMap group that fits
+	// the target space, for example a group from GenerateGroup that wastes
+	// fewer elements. P must be greater than the number of targets.
+	Group *Group
+
+	// Iterator, if set, replaces the randomly generated cyclic group walk.
+	// Each element e it returns selects the target with index e - 1, and
+	// elements outside the target space are skipped. Random is ignored, and
+	// ShardByCycle is not supported unless Iterator is a UintGroupIterator or
+	// FeistelIterator. If Iterator has an Err method, as the adapter returned
+	// by UintIteratorFromIterator does, TargetIterator.Err reports its error.
+	Iterator UintIterator
+
+	// Index, if set, is used instead of Allowed to look up the address for
+	// each target index, for example a PagedIPv4Index built from Allowed. It
+	// must contain the same addresses as Allowed.
+	Index IPv4Index
+
+	// ZMapCompatible is experimental. It walks targets with a
+	// reimplementation of the ordering in ZMap's sources, for the Seed,
+	// allowed addresses, ports and shard. It has not been checked against
+	// output of the C ziterate, so do not rely on it matching ZMap; see
+	// testdata/zmap. Random is ignored, and the iterator cannot be
+	// checkpointed, sought, or split.
+	ZMapCompatible bool
+	// Seed is the ZMap seed used when ZMapCompatible is set.
+	Seed uint64
+
+	// Sample, if set, samples targets from each allowlist line instead of
+	// walking every target. It cannot be combined with ZMapCompatible or
+	// ShardByCycle, and the iterator cannot be checkpointed or sought.
+	Sample *StratifiedSample
 }
 
 // TargetIterator maps cyclic group elements into allowed IPv4 targets.
 type TargetIterator struct {
 	allowed     *IPv4RangeSet
+	index       IPv4Index
 	ports       TargetPorts
-	iterator    Iterator
+	iterator    UintIterator
 	targetSpace uint64
 	shard       uint16
 	shards      uint16
+	sharding    ShardMode
+	cycleBegin  uint64
+	cycleEnd    uint64
+	thread      uint64
+	threads     uint64
+	split       bool
+	zmap        *zmapConstraint
+	portBits    uint
 	seen        uint64
 	emitted     uint64
 	maxTargets  uint64
+	sample      *sampler
 }
 
 // NewTargetIterator constructs a TargetIterator over the configured allowed
@@ -53,97 +211,326 @@ func NewTargetIterator(opts TargetIteratorOptions) (*TargetIterator, error) {
 	if opts.Shard >= opts.Shards {
 		return nil, fmt.Errorf("shard %d must be less than shards %d", opts.Shard, opts.Shards)
 	}
-	hi, lo := bits.Mul64(opts.Allowed.Count(), uint64(len(opts.Ports.Ports)))
-	if hi != 0 || lo > math.MaxUint64-1 {
-		return nil, fmt.Errorf("target space is too large")
+	if opts.Sharding != ShardByCount && opts.Sharding != ShardByCycle {
+		return nil, fmt.Errorf("unknown shard mode: %d", int(opts.Sharding))
 	}
-	group, err := SmallestZMapGroupFor(lo)
-	if err != nil {
-		return nil, err
+	if opts.Sample != nil && (opts.ZMapCompatible || opts.Sharding == ShardByCycle) {
+		return nil, fmt.Errorf("stratified sampling cannot be combined with ZMap compatibility or sharding by cycle")
 	}
-	var it Iterator
-	if group.P.Cmp(big.NewInt(PrimeBoundForSmallGroup)) <= 0 {
-		it, err = UintGroupIteratorFromGroup(group, opts.Random)
-	} else {
-		it, err = BigIntGroupIteratorFromGroup(group, opts.Random)
+	if opts.ZMapCompatible {
+		return newZMapTargetIterator(opts)
 	}
+	if opts.Index != nil && opts.Index.Count() != opts.Allowed.Count() {
+		return nil, fmt.Errorf("index has %d addresses, allowed set has %d", opts.Index.Count(), opts.Allowed.Count())
+	}
+	targetSpace, err := targetSpaceFor(opts.Allowed, opts.Ports)
 	if err != nil {
 		return nil, err
 	}
-	return &TargetIterator{
+	var it UintIterator
+	var length uint64
+	bounded := true
+	switch {
+	case opts.Iterator != nil:
+		it = opts.Iterator
+		switch v := it.(type) {
+		case *UintGroupIterator:
+			length, bounded = cycleLength(v.g)
+		case *FeistelIterator:
+			length = v.n
+		default:
+			if opts.Sharding == ShardByCycle {
+				return nil, fmt.Errorf("iterator %T does not support sharding by cycle", it)
+			}
+			length = math.MaxUint64
+		}
+	case opts.Ordering == OrderByFeistel:
+		if opts.Group != nil {
+			return nil, fmt.Errorf("a group cannot be used with ordering %s", opts.Ordering)
+		}
+		it, err = NewFeistelIterator(targetSpace, opts.Random)
+		if err != nil {
+			return nil, err
+		}
+		length = targetSpace
+	case opts.Ordering == OrderByGroup:
+		group, err := groupFor(opts.Group, targetSpace)
+		if err != nil {
+			return nil, err
+		}
+		it, err = groupIterator(group, opts.Random)
+		if err != nil {
+			return nil, err
+		}
+		length, bounded = cycleLength(group)
+	default:
+		return nil, fmt.Errorf("unknown ordering: %d", int(opts.Ordering))
+	}
+	out := &TargetIterator{
 		allowed:     opts.Allowed,
+		index:       opts.Index,
 		ports:       opts.Ports,
 		iterator:    it,
-		targetSpace: lo,
+		targetSpace: targetSpace,
 		shard:       opts.Shard,
 		shards:      opts.Shards,
+		sharding:    opts.Sharding,
 		maxTargets:  opts.MaxTargets,
-	}, nil
+	}
+	if opts.Sample != nil {
+		out.sample, err = newSampler(opts.Allowed, len(opts.Ports.Ports), *opts.Sample)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := out.restrictToShard(length, bounded); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// cycleLength returns the number of elements in a walk of g, and false if
+// that does not fit in a uint64, in which case it returns math.MaxUint64.
+func cycleLength(g *Group) (uint64, bool) {
+	length := big.NewInt(0).Sub(g.P, one)
+	if !length.IsUint64() {
+		return math.MaxUint64, false
+	}
+	return length.Uint64(), true
+}
+
+// groupFor returns g, after checking that it can walk targetSpace targets, or
+// the smallest ZMap group that can if g is nil.
+func groupFor(g *Group, targetSpace uint64) (*Group, error) {
+	return groupForBigInt(g, big.NewInt(0).SetUint64(targetSpace))
+}
+
+// groupForBigInt is groupFor for target spaces that may not fit in a uint64.
+func groupForBigInt(g *Group, targetSpace *big.Int) (*Group, error) {
+	if g == nil {
+		return SmallestZMapGroupForBigInt(targetSpace)
+	}
+	if err := g.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid group: %w", err)
+	}
+	if g.P.Cmp(targetSpace) <= 0 {
+		return nil, fmt.Errorf("group prime %s is too small for %s targets", g.P, targetSpace)
+	}
+	return g, nil
+}
+
+// groupIterator returns a UintIterator that walks g from a random start, using
+// a UintGroupIterator when g is small enough.
+func groupIterator(g *Group, random io.Reader) (UintIterator, error) {
+	if g.P.Cmp(big.NewInt(PrimeBoundForSmallGroup)) <= 0 {
+		return UintGroupIteratorFromGroup(g, random)
+	}
+	it, err := BigIntGroupIteratorFromGroup(g, random)
+	if err != nil {
+		return nil, err
+	}
+	return bigUintIterator{it}, nil
+}
+
+// source returns the iterator that produces the cycle, unwrapping adapters.
+func (it *TargetIterator) source() any {
+	return underlyingIterator(it.iterator)
+}
+
+// shardCycleRange returns the positions [begin, end) of a cycle of the given
+// length walked by a shard when sharding by cycle.
+func shardCycleRange(length uint64, shard, shards uint16) (uint64, uint64) {
+	bound := func(i uint64) uint64 {
+		hi, lo := bits.Mul64(i, length)
+		q, _ := bits.Div64(hi, lo, uint64(shards))
+		return q
+	}
+	return bound(uint64(shard)), bound(uint64(shard) + 1)
+}
+
+// restrictToShard limits the underlying cycle, of the given length, to the
+// shard's stretch when sharding by cycle, and to the full cycle otherwise.
+// Sharding by cycle requires a bounded cycle, one whose length fits in a
+// uint64.
+func (it *TargetIterator) restrictToShard(length uint64, bounded bool) error {
+	begin, end := uint64(0), length
+	if it.sharding == ShardByCycle {
+		if !bounded {
+			return fmt.Errorf("cannot shard a cycle of more than 2^64 elements by cycle")
+		}
+		begin, end = shardCycleRange(length, it.shard, it.shards)
+	}
+	it.cycleBegin, it.cycleEnd = begin, end
+	if it.sharding != ShardByCycle {
+		return nil
+	}
+	position, err := it.Position()
+	if err != nil {
+		return fmt.Errorf("iterator %T does not support sharding by cycle", it.source())
+	}
+	it.limitCycle(max(position, begin), end)
+	return nil
+}
+
+func targetSpaceFor(allowed *IPv4RangeSet, ports TargetPorts) (uint64, error) {
+	hi, lo := bits.Mul64(allowed.Count(), uint64(len(ports.Ports)))
+	if hi != 0 || lo > math.MaxUint64-1 {
+		return 0, fmt.Errorf("target space is too large")
+	}
+	return lo, nil
 }
 
 // Next returns the next target, or false when iteration is complete.
 func (it *TargetIterator) Next() (Target, bool) {
+	record, ok := it.NextRecord()
+	return record.Target, ok
+}
+
+// All returns an iterator over the remaining targets. Breaking out of the loop
+// leaves the iterator positioned just after the last target yielded.
+func (it *TargetIterator) All() iter.Seq[Target] {
+	return func(yield func(Target) bool) {
+		for target, ok := it.Next(); ok; target, ok = it.Next() {
+			if !yield(target) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped a custom Iterator, if any. Iteration
+// that ends without error returns nil.
+func (it *TargetIterator) Err() error {
+	if v, ok := it.iterator.(interface{ Err() error }); ok {
+		return v.Err()
+	}
+	return nil
+}
+
+// NextRecord is like Next, but also returns the index and shard of the target.
+func (it *TargetIterator) NextRecord() (TargetRecord, bool) {
 	if it.maxTargets > 0 && it.emitted >= it.maxTargets {
-		return Target{}, false
+		return TargetRecord{}, false
 	}
 	for {
-		value, ok := it.nextValue()
-		if !ok {
-			return Target{}, false
+		if it.sample != nil && it.sample.done() {
+			return TargetRecord{}, false
 		}
+		value := it.iterator.NextUint()
 		if value == 0 {
-			continue
+			return TargetRecord{}, false
 		}
 		index := value - 1
 		if index >= it.targetSpace {
 			continue
 		}
-		ipIndex := index / uint64(len(it.ports.Ports))
-		portIndex := index % uint64(len(it.ports.Ports))
-		ip, ok := it.allowed.Lookup(ipIndex)
+		var ip uint32
+		var portIndex uint64
+		var ok bool
+		if it.zmap != nil {
+			ip, portIndex, ok = it.zmapTarget(index)
+		} else {
+			ip, ok = it.addresses().Lookup(index / uint64(len(it.ports.Ports)))
+			portIndex = index % uint64(len(it.ports.Ports))
+		}
 		if !ok {
 			continue
 		}
+		if it.sample != nil && !it.sample.take(ip) {
+			continue
+		}
 		seen := it.seen
 		it.seen++
-		if seen%uint64(it.shards) != uint64(it.shard) {
+		if it.zmap == nil && it.sharding == ShardByCount && !it.ownsCount(seen) {
 			continue
 		}
 		it.emitted++
-		return Target{
-			IP:      ip,
-			Port:    it.ports.Ports[portIndex],
-			HasPort: it.ports.IncludePort,
+		return TargetRecord{
+			Target: Target{
+				IP:      ip,
+				Port:    it.ports.Ports[portIndex],
+				HasPort: it.ports.IncludePort,
+			},
+			Index: index,
+			Shard: it.shard,
+			Label: it.allowed.Label(ip),
 		}, true
 	}
 }
 
-func (it *TargetIterator) nextValue() (uint64, bool) {
-	switch v := it.iterator.(type) {
+// addresses returns the index used to look up target addresses.
+func (it *TargetIterator) addresses() IPv4Index {
+	if it.index != nil {
+		return it.index
+	}
+	return it.allowed
+}
+
+// ownsCount reports whether the seen-th allowed target belongs to this shard,
+// and to this thread if the iterator was split, when sharding by count.
+func (it *TargetIterator) ownsCount(seen uint64) bool {
+	if seen%uint64(it.shards) != uint64(it.shard) {
+		return false
+	}
+	return it.threads <= 1 || (seen/uint64(it.shards))%it.threads == it.thread
+}
+
+// Seek positions the underlying cycle so that the next target is produced by
+// the (k+1)-th element of the cycle. Positions count every element, including
+// those that do not map to an allowed target. When sharding by cycle, k is
+// clamped to the shard's stretch of the cycle. Seek is only supported for
+// iterators backed by a UintGroupIterator, BigIntGroupIterator or
+// FeistelIterator, and not when sharding by count, since the number of targets
+// before position k is unknown.
+func (it *TargetIterator) Seek(k uint64) error {
+	if (it.shards > 1 || it.threads > 1) && it.sharding == ShardByCount {
+		return fmt.Errorf("cannot seek an iterator sharded by count")
+	}
+	if it.sample != nil {
+		return fmt.Errorf("cannot seek a sampling iterator")
+	}
+	k = max(k, it.cycleBegin)
+	switch v := it.source().(type) {
 	case *UintGroupIterator:
-		out := v.NextUint()
-		return out, out != 0
+		v.Seek(k)
 	case *BigIntGroupIterator:
-		out := v.NextBigInt()
-		if out == nil || !out.IsUint64() {
-			return 0, false
-		}
-		return out.Uint64(), true
+		v.Seek(big.NewInt(0).SetUint64(k))
+	case *FeistelIterator:
+		v.Seek(k)
 	default:
-		out := it.iterator.Next()
-		if out == nil {
-			return 0, false
-		}
-		switch typed := out.(type) {
-		case uint64:
-			return typed, true
-		case *big.Int:
-			if !typed.IsUint64() {
-				return 0, false
-			}
-			return typed.Uint64(), true
-		default:
-			return 0, false
+		return fmt.Errorf("iterator %T does not support seeking", it.source())
+	}
+	return nil
+}
+
+// Skip advances the underlying cycle by n elements. It has the same
+// restrictions as Seek.
+func (it *TargetIterator) Skip(n uint64) error {
+	position, err := it.Position()
+	if err != nil {
+		return err
+	}
+	k, carry := bits.Add64(position, n, 0)
+	if carry != 0 {
+		k = math.MaxUint64
+	}
+	return it.Seek(k)
+}
+
+// Position returns the current position in the underlying cycle.
+func (it *TargetIterator) Position() (uint64, error) {
+	switch v := it.source().(type) {
+	case *UintGroupIterator:
+		return v.Position(), nil
+	case *BigIntGroupIterator:
+		position := v.Position()
+		if !position.IsUint64() {
+			return 0, fmt.Errorf("position %s does not fit in a uint64", position)
 		}
+		return position.Uint64(), nil
+	case *FeistelIterator:
+		return v.Position(), nil
+	default:
+		return 0, fmt.Errorf("iterator %T does not track its position", it.source())
 	}
 }
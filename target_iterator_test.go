@@ -1,12 +1,24 @@
 package ziterate
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 type sequenceIterator struct {
 	values []uint64
 	index  int
 }
 
+func (it *sequenceIterator) NextUint() uint64 {
+	if it.index >= len(it.values) {
+		return 0
+	}
+	out := it.values[it.index]
+	it.index++
+	return out
+}
+
 func (it *sequenceIterator) Next() interface{} {
 	if it.index >= len(it.values) {
 		return nil
@@ -78,3 +90,184 @@ func TestTargetIteratorShardingAndMaxTargets(t *testing.T) {
 		t.Fatal("Next() returned true after maxTargets")
 	}
 }
+
+func TestTargetIteratorSeek(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/24"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{80, 443}, IncludePort: true},
+		Random:  NewSeedReader(11),
+	}
+	it, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		it.Next()
+	}
+	position, err := it.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Random = NewSeedReader(11)
+	seeker, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := seeker.Skip(position); err != nil {
+		t.Fatal(err)
+	}
+	for want, ok := it.Next(); ok; want, ok = it.Next() {
+		got, gotOK := seeker.Next()
+		if !gotOK || got != want {
+			t.Fatalf("after seek got %v, %v; want %v", got, gotOK, want)
+		}
+	}
+	if _, ok := seeker.Next(); ok {
+		t.Fatal("seeker returned extra targets")
+	}
+
+	opts.Shards = 2
+	sharded, err := NewTargetIterator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sharded.Seek(10); err == nil {
+		t.Fatal("expected error seeking a sharded iterator")
+	}
+	custom := &TargetIterator{iterator: &sequenceIterator{}, shards: 1}
+	if err := custom.Seek(10); err == nil {
+		t.Fatal("expected error seeking a custom iterator")
+	}
+}
+
+func TestTargetIteratorPositionBeyondUint64(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed: allowed,
+		Ports:   TargetPorts{Ports: []uint16{0}},
+		Random:  NewSeedReader(11),
+		Group:   ZMapGroups[len(ZMapGroups)-1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := it.source().(*BigIntGroupIterator)
+	if !ok {
+		t.Fatalf("iterator is a %T, want a *BigIntGroupIterator", it.source())
+	}
+	v.Seek(big.NewInt(0).Lsh(big.NewInt(1), 70))
+	if position, err := it.Position(); err == nil {
+		t.Fatalf("Position() = %d, want an error for a position beyond 2^64", position)
+	}
+}
+
+func TestTargetIteratorShardByCycle(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/20"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const shards = 5
+	union := make(map[Target]int)
+	walked := uint64(0)
+	var length uint64
+	for shard := uint16(0); shard < shards; shard++ {
+		it, err := NewTargetIterator(TargetIteratorOptions{
+			Allowed:  allowed,
+			Ports:    TargetPorts{Ports: []uint16{80, 443}, IncludePort: true},
+			Random:   NewSeedReader(21),
+			Shard:    shard,
+			Shards:   shards,
+			Sharding: ShardByCycle,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, err := it.Position()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for target, ok := it.Next(); ok; target, ok = it.Next() {
+			union[target]++
+		}
+		end, err := it.Position()
+		if err != nil {
+			t.Fatal(err)
+		}
+		length = it.iterator.(*UintGroupIterator).prime - 1
+		if share := end - start; share > length/shards+1 {
+			t.Fatalf("shard %d walked %d of %d elements", shard, share, length)
+		}
+		walked += end - start
+	}
+	if walked != length {
+		t.Fatalf("shards walked %d elements, want %d", walked, length)
+	}
+	if got, want := len(union), 4096*2; got != want {
+		t.Fatalf("shards covered %d targets, want %d", got, want)
+	}
+	for target, n := range union {
+		if n != 1 {
+			t.Fatalf("%v emitted %d times", target, n)
+		}
+	}
+}
+
+func TestParseShardMode(t *testing.T) {
+	for _, mode := range []ShardMode{ShardByCount, ShardByCycle} {
+		got, err := ParseShardMode(mode.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != mode {
+			t.Fatalf("ParseShardMode(%q) = %v, want %v", mode.String(), got, mode)
+		}
+	}
+	if _, err := ParseShardMode("strided"); err == nil {
+		t.Fatal("expected error for unknown shard mode")
+	}
+}
+
+func TestTargetIteratorAll(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := &TargetIterator{
+		allowed:     allowed,
+		ports:       TargetPorts{Ports: []uint16{0}},
+		iterator:    &sequenceIterator{values: []uint64{3, 1, 2}},
+		targetSpace: 3,
+		shards:      1,
+	}
+	var got []uint32
+	for target := range it.All() {
+		got = append(got, target.IP)
+		break
+	}
+	for target := range it.All() {
+		got = append(got, target.IP)
+	}
+	want := []uint32{0x0a000003, 0x0a000001, 0x0a000002}
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("target %d = %#x, want %#x", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package ziterate
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OutputFormat selects how a TargetWriter serializes targets.
+type OutputFormat int
+
+const (
+	// OutputText writes one target per line, as "ip" or "ip,port". It is the
+	// default, and matches the output of ZMap's ziterate.
+	OutputText OutputFormat = iota
+
+	// OutputCSV writes a header line followed by one "ip,port,index,shard"
+	// row per target. The port column is empty for targets without a port.
+	OutputCSV
+
+	// OutputJSONLines writes one JSON object per line, with "ip", "port",
+	// "index" and "shard" fields. The port is omitted for targets without a
+	// port.
+	OutputJSONLines
+
+	// OutputBinary writes six bytes per target: the address followed by the
+	// port, both in network byte order. The port is zero for targets without
+	// a port.
+	OutputBinary
+)
+
+// BinaryTargetSize is the size of a target written in OutputBinary format.
+const BinaryTargetSize = 6
+
+// String returns the name used for the format by ParseOutputFormat.
+func (f OutputFormat) String() string {
+	switch f {
+	case OutputText:
+		return "text"
+	case OutputCSV:
+		return "csv"
+	case OutputJSONLines:
+		return "jsonl"
+	case OutputBinary:
+		return "binary"
+	default:
+		return fmt.Sprintf("OutputFormat(%d)", int(f))
+	}
+}
+
+// ParseOutputFormat parses an output format name: "text", "csv", "jsonl" or
+// "binary".
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch s {
+	case "text":
+		return OutputText, nil
+	case "csv":
+		return OutputCSV, nil
+	case "jsonl":
+		return OutputJSONLines, nil
+	case "binary":
+		return OutputBinary, nil
+	default:
+		return 0, fmt.Errorf("unknown output format: %s", s)
+	}
+}
+
+// TargetWriter serializes targets to an underlying io.Writer. Writes are
+// buffered, so Flush must be called once all targets have been written.
+type TargetWriter interface {
+	WriteTarget(record TargetRecord) error
+	Flush() error
+}
+
+// NewTargetWriter returns a TargetWriter that writes targets to w in the given
+// format.
+func NewTargetWriter(w io.Writer, format OutputFormat) (TargetWriter, error) {
+	return newTargetWriter(w, format, false)
+}
+
+// NewLabeledTargetWriter is like NewTargetWriter, but also writes each
+// target's label: as a last comma separated field in OutputText, quoted as in
+// CSV if it contains a comma or quote, a "label" column in OutputCSV, and a
+// "label" field in OutputJSONLines. OutputBinary has no room for labels, and
+// is not supported.
+func NewLabeledTargetWriter(w io.Writer, format OutputFormat) (TargetWriter, error) {
+	if format == OutputBinary {
+		return nil, fmt.Errorf("output format %s cannot include labels", format)
+	}
+	return newTargetWriter(w, format, true)
+}
+
+func newTargetWriter(w io.Writer, format OutputFormat, labels bool) (TargetWriter, error) {
+	switch format {
+	case OutputText:
+		return &textTargetWriter{w: bufio.NewWriter(w), labels: labels}, nil
+	case OutputCSV:
+		return &csvTargetWriter{w: csv.NewWriter(w), labels: labels}, nil
+	case OutputJSONLines:
+		return &jsonTargetWriter{w: bufio.NewWriter(w), labels: labels}, nil
+	case OutputBinary:
+		return &binaryTargetWriter{w: bufio.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %d", int(format))
+	}
+}
+
+type textTargetWriter struct {
+	w      *bufio.Writer
+	buf    []byte
+	labels bool
+}
+
+func (t *textTargetWriter) WriteTarget(record TargetRecord) error {
+	t.buf = appendIPv4(t.buf[:0], record.IP)
+	if record.HasPort {
+		t.buf = append(t.buf, ',')
+		t.buf = strconv.AppendUint(t.buf, uint64(record.Port), 10)
+	}
+	if t.labels {
+		t.buf = append(t.buf, ',')
+		t.buf = appendTextLabel(t.buf, record.Label)
+	}
+	t.buf = append(t.buf, '\n')
+	_, err := t.w.Write(t.buf)
+	return err
+}
+
+func (t *textTargetWriter) Flush() error {
+	return t.w.Flush()
+}
+
+// appendTextLabel appends label as a CSV field, quoted if it contains a comma,
+// quote or line break, so that labeled text lines can be split on commas.
+func appendTextLabel(buf []byte, label string) []byte {
+	if !strings.ContainsAny(label, ",\"\r\n") {
+		return append(buf, label...)
+	}
+	buf = append(buf, '"')
+	buf = append(buf, strings.ReplaceAll(label, `"`, `""`)...)
+	return append(buf, '"')
+}
+
+type csvTargetWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+	labels      bool
+	row         [5]string
+}
+
+func (c *csvTargetWriter) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	header := []string{"ip", "port", "index", "shard", "label"}
+	if !c.labels {
+		header = header[:4]
+	}
+	return c.w.Write(header)
+}
+
+func (c *csvTargetWriter) WriteTarget(record TargetRecord) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.row[0] = Uint32ToIPv4(record.IP).String()
+	c.row[1] = ""
+	if record.HasPort {
+		c.row[1] = strconv.FormatUint(uint64(record.Port), 10)
+	}
+	c.row[2] = strconv.FormatUint(record.Index, 10)
+	c.row[3] = strconv.FormatUint(uint64(record.Shard), 10)
+	if !c.labels {
+		return c.w.Write(c.row[:4])
+	}
+	c.row[4] = record.Label
+	return c.w.Write(c.row[:])
+}
+
+// Flush writes the header if no targets were written, so that the output is
+// always a valid CSV file.
+func (c *csvTargetWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonTargetWriter struct {
+	w      *bufio.Writer
+	buf    []byte
+	labels bool
+}
+
+func (j *jsonTargetWriter) WriteTarget(record TargetRecord) error {
+	b := append(j.buf[:0], `{"ip":"`...)
+	b = appendIPv4(b, record.IP)
+	b = append(b, '"')
+	if record.HasPort {
+		b = append(b, `,"port":`...)
+		b = strconv.AppendUint(b, uint64(record.Port), 10)
+	}
+	b = append(b, `,"index":`...)
+	b = strconv.AppendUint(b, record.Index, 10)
+	b = append(b, `,"shard":`...)
+	b = strconv.AppendUint(b, uint64(record.Shard), 10)
+	if j.labels {
+		label, err := json.Marshal(record.Label)
+		if err != nil {
+			return err
+		}
+		b = append(b, `,"label":`...)
+		b = append(b, label...)
+	}
+	b = append(b, "}\n"...)
+	j.buf = b
+	_, err := j.w.Write(b)
+	return err
+}
+
+func (j *jsonTargetWriter) Flush() error {
+	return j.w.Flush()
+}
+
+type binaryTargetWriter struct {
+	w   *bufio.Writer
+	buf [BinaryTargetSize]byte
+}
+
+func (b *binaryTargetWriter) WriteTarget(record TargetRecord) error {
+	binary.BigEndian.PutUint32(b.buf[:4], record.IP)
+	binary.BigEndian.PutUint16(b.buf[4:], record.Port)
+	_, err := b.w.Write(b.buf[:])
+	return err
+}
+
+func (b *binaryTargetWriter) Flush() error {
+	return b.w.Flush()
+}
+
+// appendIPv4 appends the dotted-quad form of a host byte order address.
+func appendIPv4(b []byte, ip uint32) []byte {
+	for i := 3; i >= 0; i-- {
+		b = strconv.AppendUint(b, uint64(ip>>(8*i)&0xff), 10)
+		if i > 0 {
+			b = append(b, '.')
+		}
+	}
+	return b
+}
@@ -0,0 +1,173 @@
+package ziterate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+var writerTestRecords = []TargetRecord{
+	{Target: Target{IP: 0x0a000001, Port: 80, HasPort: true}, Index: 7, Shard: 2, Label: `customer "a", west`},
+	{Target: Target{IP: 0xc0a80a0b}, Index: 0, Shard: 0},
+}
+
+func writeTestRecords(t *testing.T, format OutputFormat) string {
+	t.Helper()
+	return writeTestRecordsWith(t, format, NewTargetWriter)
+}
+
+func writeTestRecordsWith(t *testing.T, format OutputFormat, newWriter func(io.Writer, OutputFormat) (TargetWriter, error)) string {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := newWriter(&out, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range writerTestRecords {
+		if err := w.WriteTarget(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTextTargetWriter(t *testing.T) {
+	got := writeTestRecords(t, OutputText)
+	want := "10.0.0.1,80\n192.168.10.11\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSVTargetWriter(t *testing.T) {
+	got := writeTestRecords(t, OutputCSV)
+	want := "ip,port,index,shard\n10.0.0.1,80,7,2\n192.168.10.11,,0,0\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	rows, err := csv.NewReader(strings.NewReader(got)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	var empty bytes.Buffer
+	w, err := NewTargetWriter(&empty, OutputCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if empty.String() != "ip,port,index,shard\n" {
+		t.Fatalf("empty CSV output = %q, want only the header", empty.String())
+	}
+}
+
+func TestJSONLinesTargetWriter(t *testing.T) {
+	got := writeTestRecords(t, OutputJSONLines)
+	want := `{"ip":"10.0.0.1","port":80,"index":7,"shard":2}` + "\n" +
+		`{"ip":"192.168.10.11","index":0,"shard":0}` + "\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+	}
+}
+
+func TestBinaryTargetWriter(t *testing.T) {
+	got := []byte(writeTestRecords(t, OutputBinary))
+	if len(got) != len(writerTestRecords)*BinaryTargetSize {
+		t.Fatalf("got %d bytes, want %d", len(got), len(writerTestRecords)*BinaryTargetSize)
+	}
+	for i, record := range writerTestRecords {
+		b := got[i*BinaryTargetSize:]
+		if ip := binary.BigEndian.Uint32(b); ip != record.IP {
+			t.Fatalf("record %d: ip %#x, want %#x", i, ip, record.IP)
+		}
+		if port := binary.BigEndian.Uint16(b[4:]); port != record.Port {
+			t.Fatalf("record %d: port %d, want %d", i, port, record.Port)
+		}
+	}
+}
+
+func TestLabeledTargetWriter(t *testing.T) {
+	tests := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{OutputText, "10.0.0.1,80,\"customer \"\"a\"\", west\"\n192.168.10.11,\n"},
+		{OutputCSV, "ip,port,index,shard,label\n10.0.0.1,80,7,2,\"customer \"\"a\"\", west\"\n192.168.10.11,,0,0,\n"},
+		{OutputJSONLines, `{"ip":"10.0.0.1","port":80,"index":7,"shard":2,"label":"customer \"a\", west"}` + "\n" +
+			`{"ip":"192.168.10.11","index":0,"shard":0,"label":""}` + "\n"},
+	}
+	for _, tt := range tests {
+		if got := writeTestRecordsWith(t, tt.format, NewLabeledTargetWriter); got != tt.want {
+			t.Fatalf("%s: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	if _, err := NewLabeledTargetWriter(&bytes.Buffer{}, OutputBinary); err == nil {
+		t.Fatal("expected error writing labels in binary format")
+	}
+}
+
+func TestTextLabelQuoting(t *testing.T) {
+	for label, want := range map[string]string{
+		"customer-a":      "customer-a",
+		"customer a, inc": `"customer a, inc"`,
+		`say "hi"`:        `"say ""hi"""`,
+	} {
+		if got := string(appendTextLabel(nil, label)); got != want {
+			t.Fatalf("appendTextLabel(%q) = %s, want %s", label, got, want)
+		}
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, format := range []OutputFormat{OutputText, OutputCSV, OutputJSONLines, OutputBinary} {
+		got, err := ParseOutputFormat(format.String())
+		if err != nil || got != format {
+			t.Fatalf("ParseOutputFormat(%q) = %v, %v", format.String(), got, err)
+		}
+	}
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	if _, err := NewTargetWriter(&bytes.Buffer{}, OutputFormat(99)); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestTargetIteratorNextRecord(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/28"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := TargetPorts{Ports: []uint16{80, 443}, IncludePort: true}
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Ports: ports, Random: NewSeedReader(3), Shard: 1, Shards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for record, ok := it.NextRecord(); ok; record, ok = it.NextRecord() {
+		if record.Shard != 1 {
+			t.Fatalf("record shard %d, want 1", record.Shard)
+		}
+		ip, _ := allowed.Lookup(record.Index / 2)
+		if ip != record.IP || ports.Ports[record.Index%2] != record.Port {
+			t.Fatalf("index %d does not match target %+v", record.Index, record.Target)
+		}
+	}
+}
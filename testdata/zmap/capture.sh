@@ -0,0 +1,33 @@
+#!/bin/sh
+# Captures golden output from ZMap's C ziterate for TestZMapCompatibleGolden.
+# Run it from the repository root with the path to a ziterate built from a
+# tagged ZMap release:
+#
+#   testdata/zmap/capture.sh /path/to/zmap/build/src/ziterate
+#
+# Each .golden file starts with the arguments it was captured with, which the
+# test reads to configure a ZMapCompatible TargetIterator.
+set -eu
+
+ziterate=$1
+dir=testdata/zmap
+lists="-w $dir/allow.txt -b $dir/block.txt"
+
+capture() {
+	name=$1
+	shift
+	{
+		echo "# $*"
+		"$ziterate" "$@"
+	} >"$dir/$name.golden"
+}
+
+for seed in 1 12345 1099511627783; do
+	capture "seed$seed" -e "$seed" $lists
+	capture "seed$seed-ports" -e "$seed" -p 80,443,8080 $lists
+	capture "seed$seed-max" -e "$seed" -n 100 $lists
+	for shard in 0 1 2; do
+		capture "seed$seed-shard$shard-of3" -e "$seed" --shards 3 --shard "$shard" $lists
+		capture "seed$seed-shard$shard-of3-max" -e "$seed" --shards 3 --shard "$shard" -n 100 -p 80,443 $lists
+	done
+done
@@ -2,10 +2,107 @@
 // finite target space in a randomized order without tracking visited elements.
 package ziterate
 
-// Iterator is the common interface for cyclic group iterators.
+import (
+	"fmt"
+	"math/big"
+)
+
+// Iterator is the untyped interface for cyclic group iterators. It boxes every
+// element, so new code should use UintIterator or BigIterator instead.
 //
 // Next returns the next element, or nil after the iterator has completed one
 // full cycle.
 type Iterator interface {
 	Next() interface{}
 }
+
+// UintIterator is implemented by iterators whose elements fit in a uint64.
+// NextUint returns the next element, or 0 once iteration is complete, so 0 can
+// never be an element. UintGroupIterator implements it, and custom iterators
+// implementing it can drive a TargetIterator.
+type UintIterator interface {
+	NextUint() uint64
+}
+
+// BigIterator is implemented by iterators whose elements are arbitrary size.
+// NextBigInt returns the next element, or nil once iteration is complete.
+// BigIntGroupIterator implements it.
+type BigIterator interface {
+	NextBigInt() *big.Int
+}
+
+// UintIteratorFromIterator adapts an untyped Iterator to a UintIterator. The
+// Iterator must return uint64 or *big.Int elements that fit in a uint64. If it
+// returns anything else, the adapter stops iteration, and Err on a
+// TargetIterator that it drives reports the element.
+func UintIteratorFromIterator(it Iterator) UintIterator {
+	return &legacyUintIterator{Iterator: it}
+}
+
+// UintIteratorFromBigIterator adapts a BigIterator to a UintIterator. Elements
+// that do not fit in a uint64 are skipped.
+func UintIteratorFromBigIterator(it BigIterator) UintIterator {
+	return bigUintIterator{it}
+}
+
+type legacyUintIterator struct {
+	Iterator
+	err error
+}
+
+func (it *legacyUintIterator) NextUint() uint64 {
+	if it.err != nil {
+		return 0
+	}
+	out := it.Next()
+	switch v := out.(type) {
+	case nil:
+		return 0
+	case uint64:
+		return v
+	case *big.Int:
+		if v == nil {
+			return 0
+		}
+		if v.IsUint64() {
+			return v.Uint64()
+		}
+		it.err = fmt.Errorf("iterator %T returned %s, which does not fit in a uint64", it.Iterator, v)
+	default:
+		it.err = fmt.Errorf("iterator %T returned unsupported element type %T", it.Iterator, out)
+	}
+	return 0
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *legacyUintIterator) Err() error {
+	return it.err
+}
+
+type bigUintIterator struct {
+	BigIterator
+}
+
+func (it bigUintIterator) NextUint() uint64 {
+	for {
+		out := it.NextBigInt()
+		if out == nil {
+			return 0
+		}
+		if out.IsUint64() {
+			return out.Uint64()
+		}
+	}
+}
+
+// underlyingIterator returns the iterator wrapped by an adapter, or it itself.
+func underlyingIterator(it UintIterator) any {
+	switch v := it.(type) {
+	case *legacyUintIterator:
+		return v.Iterator
+	case bigUintIterator:
+		return v.BigIterator
+	default:
+		return it
+	}
+}
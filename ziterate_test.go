@@ -1 +1,180 @@
 package ziterate
+
+import (
+	"math/big"
+	"testing"
+)
+
+type bigSequenceIterator struct {
+	values []*big.Int
+}
+
+func (it *bigSequenceIterator) NextBigInt() *big.Int {
+	if len(it.values) == 0 {
+		return nil
+	}
+	out := it.values[0]
+	it.values = it.values[1:]
+	return out
+}
+
+type untypedSequenceIterator struct {
+	values []interface{}
+}
+
+func (it *untypedSequenceIterator) Next() interface{} {
+	if len(it.values) == 0 {
+		return nil
+	}
+	out := it.values[0]
+	it.values = it.values[1:]
+	return out
+}
+
+func collectUints(it UintIterator) []uint64 {
+	var out []uint64
+	for x := it.NextUint(); x != 0; x = it.NextUint() {
+		out = append(out, x)
+	}
+	return out
+}
+
+func equalUints(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUintIteratorFromIterator(t *testing.T) {
+	it := UintIteratorFromIterator(&untypedSequenceIterator{
+		values: []interface{}{uint64(3), big.NewInt(9), uint64(4)},
+	})
+	if got, want := collectUints(it), []uint64{3, 9, 4}; !equalUints(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	huge := big.NewInt(0).Lsh(big.NewInt(1), 70)
+	for _, bad := range []interface{}{huge, "x"} {
+		it := UintIteratorFromIterator(&untypedSequenceIterator{
+			values: []interface{}{uint64(3), bad, uint64(4)},
+		})
+		if got, want := collectUints(it), []uint64{3}; !equalUints(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if it.NextUint() != 0 {
+			t.Fatalf("adapter continued after %v", bad)
+		}
+		if it.(*legacyUintIterator).Err() == nil {
+			t.Fatalf("no error after %v", bad)
+		}
+	}
+}
+
+func TestTargetIteratorErr(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed:  allowed,
+		Iterator: UintIteratorFromIterator(&untypedSequenceIterator{values: []interface{}{uint64(2), "x", uint64(1)}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets := collectTargets(it); len(targets) != 1 || targets[0].IP != 0x0a000001 {
+		t.Fatalf("got %v, want [10.0.0.1]", targets)
+	}
+	if it.Err() == nil {
+		t.Fatal("Err() = nil after the iterator returned a string")
+	}
+
+	plain, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectTargets(plain)
+	if err := plain.Err(); err != nil {
+		t.Fatalf("Err() = %v after iteration completed", err)
+	}
+}
+
+func TestUintIteratorFromBigIterator(t *testing.T) {
+	huge := big.NewInt(0).Lsh(big.NewInt(1), 70)
+	it := UintIteratorFromBigIterator(&bigSequenceIterator{
+		values: []*big.Int{big.NewInt(1), huge, big.NewInt(2)},
+	})
+	if got, want := collectUints(it), []uint64{1, 2}; !equalUints(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestTargetIteratorCustomIterator(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed:  allowed,
+		Iterator: &sequenceIterator{values: []uint64{3, 7, 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []uint32
+	for target := range it.All() {
+		got = append(got, target.IP)
+	}
+	if len(got) != 2 || got[0] != 0x0a000003 || got[1] != 0x0a000001 {
+		t.Fatalf("got %#x, want [0xa000003 0xa000001]", got)
+	}
+
+	_, err = NewTargetIterator(TargetIteratorOptions{
+		Allowed:  allowed,
+		Iterator: &sequenceIterator{},
+		Shards:   2,
+		Sharding: ShardByCycle,
+	})
+	if err == nil {
+		t.Fatal("expected error sharding a custom iterator by cycle")
+	}
+
+	group, err := UintGroupIteratorFromGroup(ZMapGroups[0], NewSeedReader(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grouped, err := NewTargetIterator(TargetIteratorOptions{
+		Allowed:  allowed,
+		Iterator: group,
+		Shards:   2,
+		Sharding: ShardByCycle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := grouped.Seek(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTargetIteratorNextDoesNotAllocate(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{AllowEntries: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := NewTargetIterator(TargetIteratorOptions{Allowed: allowed, Random: NewSeedReader(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs := testing.AllocsPerRun(1000, func() { it.Next() }); allocs != 0 {
+		t.Fatalf("Next allocated %v times per call", allocs)
+	}
+}
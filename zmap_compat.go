@@ -0,0 +1,236 @@
+package ziterate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// This file reimplements the parts of ZMap that decide the order of targets,
+// for the experimental TargetIteratorOptions.ZMapCompatible. Until output of
+// the C ziterate is captured in testdata/zmap, it is not known to match:
+//
+//   - aesrand.c: the seed keys AES-128, and every random word is the first
+//     eight bytes (little-endian) of the previous output block re-encrypted.
+//   - cyclic.c: the generator is the known primitive root raised to a random
+//     exponent coprime to P - 1, and the walk starts at generator^offset.
+//   - shard.c: shard i of n starts at exponent offset + i and steps by n, so
+//     shards interleave through the cycle instead of filtering it.
+//   - constraint.c: index-to-address lookup lists every fully allowed /20
+//     first, then the remaining allowed addresses, each in ascending order.
+//   - iterator.c: target indexes pack the port index into the low
+//     ceil(log2(ports)) bits rather than multiplying by the port count.
+
+// zmapRadixBits is RADIX_LENGTH in ZMap's constraint.c.
+const zmapRadixBits = 20
+
+// zmapRand is ZMap's aesrand generator.
+type zmapRand struct {
+	block cipher.Block
+	state [aes.BlockSize]byte
+}
+
+func newZMapRand(seed uint64) *zmapRand {
+	var key [16]byte
+	binary.LittleEndian.PutUint64(key[:8], seed)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return &zmapRand{block: block}
+}
+
+func (r *zmapRand) word() uint64 {
+	r.block.Encrypt(r.state[:], r.state[:])
+	return binary.LittleEndian.Uint64(r.state[:8])
+}
+
+// zmapCoprime is check_coprime from ZMap's cyclic.c. It rejects 0 and 1, and
+// any candidate sharing a prime factor with P - 1.
+func zmapCoprime(candidate uint64, g *Group) bool {
+	if candidate == 0 || candidate == 1 {
+		return false
+	}
+	for _, factor := range g.OrderFactors {
+		f := factor.Uint64()
+		if f > candidate && f%candidate == 0 {
+			return false
+		} else if f < candidate && candidate%f == 0 {
+			return false
+		} else if f == candidate {
+			return false
+		}
+	}
+	return true
+}
+
+// zmapCycle is cycle_t from ZMap's cyclic.c.
+type zmapCycle struct {
+	prime     uint64
+	generator uint64
+	offset    uint64
+	order     uint64
+}
+
+// makeZMapCycle is make_cycle from ZMap's cyclic.c.
+func makeZMapCycle(g *Group, r *zmapRand) zmapCycle {
+	prime := g.P.Uint64()
+	candidate := uint32((r.word() & 0xFFFFFFFF) % prime)
+	for !zmapCoprime(uint64(candidate), g) {
+		candidate++
+	}
+	generator := big.NewInt(0).Exp(g.KnownRoot, big.NewInt(int64(candidate)), g.P)
+	offset := (r.word() & 0xFFFFFFFF) % prime
+	return zmapCycle{
+		prime:     prime,
+		generator: generator.Uint64(),
+		offset:    offset,
+		order:     prime - 1,
+	}
+}
+
+// zmapShardIterator walks one ZMap shard, as set up by shard_init in ZMap's
+// shard.c. It returns group elements, and 0 once the shard is complete.
+type zmapShardIterator struct {
+	prime   uint64
+	factor  uint64
+	first   uint64
+	last    uint64
+	current uint64
+	started bool
+}
+
+func newZMapShardIterator(c zmapCycle, shard, shards uint16) *zmapShardIterator {
+	numSubshards := uint64(shards)
+	subIdx := uint64(shard)
+	begin := (c.offset + subIdx) % c.order
+	elements := c.order / numSubshards
+	if subIdx < c.order%numSubshards {
+		elements++
+	}
+	hi, lo := bits.Mul64(elements, numSubshards)
+	end := bits.Rem64(hi, lo, c.order)
+	end = (begin + end) % c.order
+	first := powMod(c.generator, begin, c.prime)
+	return &zmapShardIterator{
+		prime:   c.prime,
+		factor:  powMod(c.generator, numSubshards, c.prime),
+		first:   first,
+		last:    powMod(c.generator, end, c.prime),
+		current: first,
+	}
+}
+
+// NextUint returns the next element of the shard. The first element is the
+// start of the shard itself, and the shard ends just before it reaches its
+// last element.
+func (it *zmapShardIterator) NextUint() uint64 {
+	if it.current == 0 {
+		return 0
+	}
+	if !it.started {
+		it.started = true
+		return it.current
+	}
+	it.current = mulMod(it.current, it.factor, it.prime)
+	if it.current == it.last {
+		it.current = 0
+	}
+	return it.current
+}
+
+// zmapConstraint maps indexes to allowed addresses in the order used by
+// constraint_lookup_index in ZMap's constraint.c.
+type zmapConstraint struct {
+	radix []uint32
+	tree  *IPv4RangeSet
+}
+
+func newZMapConstraint(set *IPv4RangeSet) *zmapConstraint {
+	const blockSize = uint64(1) << (32 - zmapRadixBits)
+	out := &zmapConstraint{}
+	var rest []IPv4Range
+	for _, r := range set.ranges {
+		start, end := uint64(r.Start), uint64(r.End)+1
+		firstBlock := (start + blockSize - 1) / blockSize * blockSize
+		lastBlock := end / blockSize * blockSize
+		if firstBlock >= lastBlock {
+			rest = append(rest, IPv4Range{Start: r.Start, End: r.End})
+			continue
+		}
+		if start < firstBlock {
+			rest = append(rest, IPv4Range{Start: r.Start, End: uint32(firstBlock - 1)})
+		}
+		for block := firstBlock; block < lastBlock; block += blockSize {
+			out.radix = append(out.radix, uint32(block))
+		}
+		if lastBlock < end {
+			rest = append(rest, IPv4Range{Start: uint32(lastBlock), End: r.End})
+		}
+	}
+	rest = withCumulativeCounts(rest)
+	out.tree = &IPv4RangeSet{ranges: rest}
+	if len(rest) > 0 {
+		out.tree.total = rest[len(rest)-1].CumEnd
+	}
+	return out
+}
+
+// Lookup returns the index-th allowed address in ZMap's order.
+func (c *zmapConstraint) Lookup(index uint64) (uint32, bool) {
+	const blockBits = 32 - zmapRadixBits
+	radixIdx := index >> blockBits
+	if radixIdx < uint64(len(c.radix)) {
+		return c.radix[radixIdx] | uint32(index&(1<<blockBits-1)), true
+	}
+	return c.tree.Lookup(index - uint64(len(c.radix))<<blockBits)
+}
+
+// zmapBitsForPort returns the number of low bits ZMap reserves for the port
+// index of a target.
+func zmapBitsForPort(ports int) uint {
+	return uint(bits.Len(uint(ports - 1)))
+}
+
+// newZMapTargetIterator constructs a TargetIterator that walks targets in the
+// same order as ZMap.
+func newZMapTargetIterator(opts TargetIteratorOptions) (*TargetIterator, error) {
+	if opts.Sharding != ShardByCount {
+		return nil, fmt.Errorf("shard mode %s is not supported in ZMap compatibility mode", opts.Sharding)
+	}
+	count := opts.Allowed.Count()
+	if uint64(opts.Shards) > count {
+		return nil, fmt.Errorf("%d shards is more than the %d allowed addresses", opts.Shards, count)
+	}
+	portBits := zmapBitsForPort(len(opts.Ports.Ports))
+	targetSpace := count << portBits
+	group, err := SmallestZMapGroupFor(targetSpace)
+	if err != nil {
+		return nil, err
+	}
+	cycle := makeZMapCycle(group, newZMapRand(opts.Seed))
+	return &TargetIterator{
+		allowed:     opts.Allowed,
+		ports:       opts.Ports,
+		iterator:    newZMapShardIterator(cycle, opts.Shard, opts.Shards),
+		targetSpace: targetSpace,
+		shard:       opts.Shard,
+		shards:      opts.Shards,
+		maxTargets:  opts.MaxTargets,
+		zmap:        newZMapConstraint(opts.Allowed),
+		portBits:    portBits,
+	}, nil
+}
+
+// zmapTarget maps a ZMap target index to an allowed address and port index.
+func (it *TargetIterator) zmapTarget(index uint64) (uint32, uint64, bool) {
+	portIndex := index & (1<<it.portBits - 1)
+	if portIndex >= uint64(len(it.ports.Ports)) {
+		return 0, 0, false
+	}
+	ip, ok := it.zmap.Lookup(index >> it.portBits)
+	return ip, portIndex, ok
+}
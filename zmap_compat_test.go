@@ -0,0 +1,239 @@
+package ziterate
+
+import (
+	"bytes"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestZMapRandMatchesAES(t *testing.T) {
+	// AES-128 with an all-zero key maps the zero block to
+	// 66e94bd4ef8a2c3b884cfa59ca342b2e.
+	r := newZMapRand(0)
+	if got, want := r.word(), uint64(0x3b2c8aefd44be966); got != want {
+		t.Fatalf("first word = %#x, want %#x", got, want)
+	}
+	if a, b := newZMapRand(1).word(), newZMapRand(2).word(); a == b {
+		t.Fatal("different seeds produced the same word")
+	}
+}
+
+func TestZMapCoprime(t *testing.T) {
+	g := &Group{
+		P:            big.NewInt(23),
+		KnownRoot:    big.NewInt(5),
+		OrderFactors: []*big.Int{big.NewInt(2), big.NewInt(11)},
+	}
+	coprime := map[uint64]bool{3: true, 5: true, 7: true, 9: true, 13: true, 15: true, 17: true, 19: true, 21: true}
+	for candidate := uint64(0); candidate < 22; candidate++ {
+		if got := zmapCoprime(candidate, g); got != coprime[candidate] {
+			t.Errorf("zmapCoprime(%d) = %v", candidate, got)
+		}
+	}
+}
+
+func TestMakeZMapCycleGenerator(t *testing.T) {
+	for _, g := range ZMapGroups {
+		for seed := uint64(0); seed < 8; seed++ {
+			c := makeZMapCycle(g, newZMapRand(seed))
+			if err := g.checkIfMultiplicativeGenerator(big.NewInt(0).SetUint64(c.generator)); err != nil {
+				t.Fatalf("group %s seed %d: %s", g.P, seed, err)
+			}
+			if c.offset >= c.prime {
+				t.Fatalf("group %s seed %d: offset %d out of range", g.P, seed, c.offset)
+			}
+		}
+	}
+}
+
+func TestZMapShardIteratorPartitionsCycle(t *testing.T) {
+	g := ZMapGroups[1]
+	c := makeZMapCycle(g, newZMapRand(7))
+	for _, shards := range []uint16{1, 2, 3, 7} {
+		seen := make(map[uint64]bool)
+		for shard := uint16(0); shard < shards; shard++ {
+			it := newZMapShardIterator(c, shard, shards)
+			first := true
+			for x := it.NextUint(); x != 0; x = it.NextUint() {
+				if first && x != powMod(c.generator, (c.offset+uint64(shard))%c.order, c.prime) {
+					t.Fatalf("shard %d of %d starts at %d", shard, shards, x)
+				}
+				first = false
+				if seen[x] {
+					t.Fatalf("%d emitted twice with %d shards", x, shards)
+				}
+				seen[x] = true
+			}
+		}
+		if uint64(len(seen)) != c.order {
+			t.Fatalf("%d shards emitted %d elements, want %d", shards, len(seen), c.order)
+		}
+	}
+}
+
+func TestZMapConstraintRadixFirst(t *testing.T) {
+	set, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/19", "10.0.32.5", "9.255.255.254"},
+		BlockEntries: []string{"10.0.16.7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newZMapConstraint(set)
+	if len(c.radix) != 1 || c.radix[0] != 0x0a000000 {
+		t.Fatalf("radix = %#x, want [0x0a000000]", c.radix)
+	}
+	tests := []struct {
+		index uint64
+		want  uint32
+	}{
+		{0, 0x0a000000},
+		{4095, 0x0a000fff},
+		{4096, 0x09fffffe},
+		{4097, 0x0a001000},
+		{4097 + 7, 0x0a001008},
+		{set.Count() - 1, 0x0a002005},
+	}
+	for _, tc := range tests {
+		got, ok := c.Lookup(tc.index)
+		if !ok || got != tc.want {
+			t.Fatalf("Lookup(%d) = %#x, %v; want %#x", tc.index, got, ok, tc.want)
+		}
+	}
+	if _, ok := c.Lookup(set.Count()); ok {
+		t.Fatal("Lookup(Count()) returned true")
+	}
+}
+
+func TestZMapBitsForPort(t *testing.T) {
+	for ports, want := range map[int]uint{1: 0, 2: 1, 3: 2, 4: 2, 5: 3, 1 << 16: 16} {
+		if got := zmapBitsForPort(ports); got != want {
+			t.Errorf("zmapBitsForPort(%d) = %d, want %d", ports, got, want)
+		}
+	}
+}
+
+func TestTargetIteratorZMapCompatible(t *testing.T) {
+	allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+		AllowEntries: []string{"10.0.0.0/22", "192.0.2.0/28"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := TargetPorts{Ports: []uint16{22, 80, 443}, IncludePort: true}
+	run := func(shard, shards uint16) []Target {
+		it, err := NewTargetIterator(TargetIteratorOptions{
+			Allowed:        allowed,
+			Ports:          ports,
+			Shard:          shard,
+			Shards:         shards,
+			ZMapCompatible: true,
+			Seed:           1234,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return collectTargets(it)
+	}
+	first := run(0, 1)
+	if got, want := len(first), (1024+16)*3; got != want {
+		t.Fatalf("got %d targets, want %d", got, want)
+	}
+	again := run(0, 1)
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("target %d differs between runs: %v, %v", i, first[i], again[i])
+		}
+	}
+	union := make(map[Target]int)
+	for shard := uint16(0); shard < 4; shard++ {
+		for _, target := range run(shard, 4) {
+			union[target]++
+		}
+	}
+	for _, target := range first {
+		if union[target] != 1 {
+			t.Fatalf("%v emitted %d times across shards", target, union[target])
+		}
+	}
+}
+
+// TestZMapCompatibleGolden compares ZMapCompatible with output captured from
+// the C ziterate by testdata/zmap/capture.sh. Each golden file starts with the
+// arguments it was captured with.
+func TestZMapCompatibleGolden(t *testing.T) {
+	goldens, err := filepath.Glob(filepath.Join("testdata", "zmap", "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goldens) == 0 {
+		t.Skip("no output captured from the C ziterate; run testdata/zmap/capture.sh")
+	}
+	for _, path := range goldens {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, want, ok := strings.Cut(string(data), "\n")
+			if !ok || !strings.HasPrefix(header, "# ") {
+				t.Fatalf("%s does not start with the captured arguments", path)
+			}
+			args := strings.Fields(strings.TrimPrefix(header, "# "))
+			flags := flag.NewFlagSet("ziterate", flag.ContinueOnError)
+			seed := flags.Uint64("e", 0, "")
+			portsDef := flags.String("p", "", "")
+			maxTargets := flags.Uint64("n", 0, "")
+			shard := flags.Uint("shard", 0, "")
+			shards := flags.Uint("shards", 1, "")
+			allowFile := flags.String("w", "", "")
+			blockFile := flags.String("b", "", "")
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			allowed, err := NewIPv4RangeSet(IPv4RangeSetOptions{
+				AllowFiles: []string{*allowFile},
+				BlockFiles: []string{*blockFile},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ports, err := ParseTargetPorts(*portsDef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			it, err := NewTargetIterator(TargetIteratorOptions{
+				Allowed:        allowed,
+				Ports:          ports,
+				Shard:          uint16(*shard),
+				Shards:         uint16(*shards),
+				MaxTargets:     *maxTargets,
+				ZMapCompatible: true,
+				Seed:           *seed,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			w, err := NewTargetWriter(&out, OutputText)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for record, ok := it.NextRecord(); ok; record, ok = it.NextRecord() {
+				if err := w.WriteTarget(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Fatalf("output for %s differs from the C ziterate", header)
+			}
+		})
+	}
+}